@@ -0,0 +1,270 @@
+package config
+
+import (
+	"crypto/rand"
+	"log"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // so CAMPUS_TIMEZONE works on hosts without a zoneinfo database
+)
+
+// Config is everything the server reads from the environment (or .env) at startup.
+type Config struct {
+	StorageBackend string // "mongo" (default) or "memory"
+	// MigrateOnStartup applies pending schema migrations before serving. When off,
+	// run "nitabuddy migrate" as a separate deploy step.
+	MigrateOnStartup bool
+	// AllowNonTransactional lets the server run against a MongoDB without transactions,
+	// e.g. a standalone mongod in development. Related writes are then not atomic.
+	AllowNonTransactional bool
+	JWT                   JWTConfig
+	Campus                CampusConfig
+	Mail                  MailConfig
+	Orders                OrderConfig
+
+	// EmailVerificationTTL is how long a verification link stays valid
+	EmailVerificationTTL time.Duration
+	// PasswordResetTTL is how long a password reset token stays valid
+	PasswordResetTTL time.Duration
+}
+
+type JWTConfig struct {
+	Secret     []byte
+	Issuer     string
+	Audience   string
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// CampusConfig describes the institute. Registration input is validated against it.
+type CampusConfig struct {
+	EmailDomain       string // if set, only addresses at this domain may register
+	EnrollmentPattern *regexp.Regexp
+	Hostels           []string
+	Branches          []string
+	Years             []string
+	StoreCategories   []string
+	Timezone          *time.Location // store opening hours are in campus time
+
+	// HostelDistances gives the distance between neighbouring hostels, in any unit, in the
+	// direction each entry names it. models.NewHostelMap decides how they apply both ways
+	// and finds the shortest route between hostels that are not neighbours.
+	HostelDistances map[string]map[string]int
+}
+
+// MailConfig selects how outgoing email is delivered.
+type MailConfig struct {
+	Sender   string // "log", "file" or "smtp"; defaults to "log" only with the memory backend
+	FilePath string
+	From     string
+	SMTPHost string
+	SMTPPort int
+	SMTPUser string
+	SMTPPass string
+}
+
+// OrderConfig controls how long unaccepted orders stay in the feed and how often a
+// runner may hand accepted orders back.
+type OrderConfig struct {
+	DefaultTTL    time.Duration
+	MaxTTL        time.Duration            // longest expiry a placer may choose
+	StoreTTLs     map[string]time.Duration // per-store default, keyed by lower-cased store name
+	SweepInterval time.Duration            // how often expired orders are closed and refunded
+
+	FreeReleases   int           // releases a runner may make per ReleaseWindow without penalty
+	ReleaseWindow  time.Duration // period over which releases are counted
+	ReleasePenalty int           // coins paid to the placer for each further release; 0 refuses them
+}
+
+// Load reads the configuration. Call it after godotenv.Load.
+func Load() *Config {
+	storageBackend := getEnv("STORAGE_BACKEND", "mongo")
+
+	// A real deployment has to choose how mail goes out; NewMailer refuses an empty Sender
+	mailSender := ""
+	if storageBackend == "memory" {
+		mailSender = "log"
+	}
+
+	cfg := &Config{
+		StorageBackend:        storageBackend,
+		MigrateOnStartup:      getBool("MIGRATE_ON_STARTUP", true),
+		AllowNonTransactional: getBool("ALLOW_NON_TRANSACTIONAL", false),
+		JWT: JWTConfig{
+			Secret:     []byte(os.Getenv("JWT_SECRET")),
+			Issuer:     getEnv("JWT_ISSUER", "nitabuddy"),
+			Audience:   getEnv("JWT_AUDIENCE", "nitabuddy-app"),
+			AccessTTL:  getDuration("JWT_ACCESS_TTL", 15*time.Minute),
+			RefreshTTL: getDuration("JWT_REFRESH_TTL", 30*24*time.Hour),
+		},
+		Campus: CampusConfig{
+			EmailDomain:       strings.ToLower(os.Getenv("INSTITUTE_EMAIL_DOMAIN")),
+			EnrollmentPattern: getRegexp("ENROLLMENT_PATTERN", `^[0-9]{2}[A-Z]{2,4}[0-9]{3}$`),
+			Hostels:           getList("CAMPUS_HOSTELS", "BH1,BH2,BH3,BH4,BH5,BH6,BH7,BH8,BH9,BH10,GH1,GH2,GH3"),
+			Branches:          getList("CAMPUS_BRANCHES", "CSE,ECE,EE,EIE,ME,CE,CHE,PE,BT,MATH,PHY,CHEM"),
+			Years:             getList("CAMPUS_YEARS", "1,2,3,4,5"),
+			StoreCategories:   getList("STORE_CATEGORIES", "food,grocery,stationery,pharmacy,printing,other"),
+			Timezone:          getLocation("CAMPUS_TIMEZONE", "Asia/Kolkata"),
+		},
+		Mail: MailConfig{
+			Sender:   getEnv("MAIL_SENDER", mailSender),
+			FilePath: getEnv("MAIL_FILE", "mail.log"),
+			From:     getEnv("MAIL_FROM", "NITA Buddy <no-reply@nitabuddy.app>"),
+			SMTPHost: os.Getenv("SMTP_HOST"),
+			SMTPPort: getInt("SMTP_PORT", 587),
+			SMTPUser: os.Getenv("SMTP_USER"),
+			SMTPPass: os.Getenv("SMTP_PASSWORD"),
+		},
+		Orders: OrderConfig{
+			DefaultTTL:    getDuration("ORDER_DEFAULT_TTL", time.Hour),
+			MaxTTL:        getDuration("ORDER_MAX_TTL", 12*time.Hour),
+			StoreTTLs:     getDurationMap("ORDER_STORE_TTLS"),
+			SweepInterval: getPositiveDuration("ORDER_EXPIRY_SWEEP_INTERVAL", time.Minute),
+
+			FreeReleases:   getInt("ORDER_FREE_RELEASES", 2),
+			ReleaseWindow:  getDuration("ORDER_RELEASE_WINDOW", 24*time.Hour),
+			ReleasePenalty: getInt("ORDER_RELEASE_PENALTY", 5),
+		},
+		EmailVerificationTTL: getDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+		PasswordResetTTL:     getDuration("PASSWORD_RESET_TTL", 30*time.Minute),
+	}
+
+	cfg.Campus.HostelDistances = getHostelDistances("HOSTEL_DISTANCES", cfg.Campus.Hostels)
+
+	if len(cfg.JWT.Secret) == 0 {
+		// Never fall back to a well-known key: a random one is safe, it just logs everyone out on restart
+		log.Println("JWT_SECRET is not set; using a random secret, tokens will not survive a restart")
+		cfg.JWT.Secret = make([]byte, 32)
+		if _, err := rand.Read(cfg.JWT.Secret); err != nil {
+			log.Fatalf("Failed to generate JWT secret: %v", err)
+		}
+	}
+
+	return cfg
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return d
+}
+
+// getPositiveDuration is getDuration for settings that drive a ticker, which cannot be zero or negative.
+func getPositiveDuration(key string, fallback time.Duration) time.Duration {
+	d := getDuration(key, fallback)
+	if d <= 0 {
+		log.Fatalf("Invalid %s %q: must be positive", key, os.Getenv(key))
+	}
+	return d
+}
+
+// getDurationMap reads comma-separated name=duration pairs, e.g. "Canteen=30m,Amul=2h".
+// Names are lower-cased.
+func getDurationMap(key string) map[string]time.Duration {
+	durations := make(map[string]time.Duration)
+	for _, item := range getList(key, "") {
+		name, value, ok := strings.Cut(item, "=")
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if !ok || err != nil {
+			log.Fatalf("Invalid %s entry %q: want name=duration", key, item)
+		}
+		durations[strings.ToLower(strings.TrimSpace(name))] = d
+	}
+	return durations
+}
+
+func getInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return n
+}
+
+func getBool(key string, fallback bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return b
+}
+
+// getLocation loads an IANA time zone such as "Asia/Kolkata".
+func getLocation(key, fallback string) *time.Location {
+	location, err := time.LoadLocation(getEnv(key, fallback))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return location
+}
+
+// getHostelDistances reads a list of hostel:hostel=distance entries between known hostels.
+func getHostelDistances(key string, hostels []string) map[string]map[string]int {
+	distances := make(map[string]map[string]int)
+	for _, item := range getList(key, "") {
+		pair, value, ok := strings.Cut(item, "=")
+		a, b, isPair := strings.Cut(pair, ":")
+		a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+		d, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || !isPair || err != nil || d < 0 {
+			log.Fatalf("Invalid %s entry %q: want hostel:hostel=distance", key, item)
+		}
+		if !slices.Contains(hostels, a) || !slices.Contains(hostels, b) {
+			log.Fatalf("Invalid %s entry %q: unknown hostel", key, item)
+		}
+
+		if distances[a] == nil {
+			distances[a] = make(map[string]int)
+		}
+		distances[a][b] = d
+	}
+	return distances
+}
+
+// getList reads a comma-separated list, dropping blanks around and between items.
+func getList(key, fallback string) []string {
+	var items []string
+	for _, item := range strings.Split(getEnv(key, fallback), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getRegexp(key, fallback string) *regexp.Regexp {
+	v := getEnv(key, fallback)
+	re, err := regexp.Compile(v)
+	if err != nil {
+		log.Fatalf("Invalid %s %q: %v", key, v, err)
+	}
+	return re
+}
@@ -11,8 +11,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Connect establishes a connection to MongoDB and returns the client and collections
-func Connect() (*mongo.Client, *mongo.Collection, *mongo.Collection, *mongo.Collection) {
+// Connect establishes a connection to MongoDB and returns the client and the application database
+func Connect() (*mongo.Client, *mongo.Database) {
 
 	// connect to MongoDB
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -27,18 +27,74 @@ func Connect() (*mongo.Client, *mongo.Collection, *mongo.Collection, *mongo.Coll
 		log.Fatal(err)
 	}
 
-	// Initialize Collections
 	db := client.Database("nita_buddy")
-	userCollection := db.Collection("users")
-	orderCollection := db.Collection("orders")
-	rewardsCollection := db.Collection("rewards")
 
 	// check connection by running a query
-	err = userCollection.FindOne(ctx, bson.M{}).Err()
+	err = db.Collection("users").FindOne(ctx, bson.M{}).Err()
 	if err != nil && err != mongo.ErrNoDocuments {
 		log.Fatalf("Failed to query user Collection: %v", err)
 	}
 
 	log.Println("Successfully connected to NITA Buddy Database")
-	return client, userCollection, orderCollection, rewardsCollection
+	return client, db
+}
+
+// indexes lists, per collection, the indexes the application relies on.
+var indexes = map[string][]mongo.IndexModel{
+	"users": {
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		// Accounts from before enrollment was validated may have none; only real numbers must be unique
+		{Keys: bson.D{{Key: "enrollment", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"enrollment": bson.M{"$gt": ""}})},
+	},
+	"orders": {
+		{Keys: bson.D{{Key: "custom_order_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "placed_by", Value: 1}}},
+		{Keys: bson.D{{Key: "accepted_by", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "expires_at", Value: 1}}},
+		// Order lists are sorted by created_at, with _id breaking ties
+		{Keys: bson.D{{Key: "placed_by", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "accepted_by", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+	},
+	"ledger": {
+		{Keys: bson.D{{Key: "account", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"refresh_tokens": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	},
+	// Revoked access tokens are only needed until the token would have expired anyway
+	"revoked_tokens": {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	// Spent and expired password reset tokens are kept only until they expire
+	"password_resets": {
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	// Store names are unique regardless of case, so one shop cannot be listed twice
+	"stores": {
+		{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true).
+			SetCollation(&options.Collation{Locale: "en", Strength: 2})},
+		{Keys: bson.D{{Key: "category", Value: 1}}},
+	},
+}
+
+// EnsureIndexes creates the indexes the application relies on, creating collections as
+// needed. Creating an index that already exists is a no-op, so this is safe to run on every startup.
+func EnsureIndexes(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for collection, models := range indexes {
+		_, err := db.Collection(collection).Indexes().CreateMany(ctx, models)
+		if mongo.IsDuplicateKeyError(err) {
+			log.Fatalf("Failed to create unique index on %s: existing documents contain duplicates, remove them first: %v", collection, err)
+		}
+		if err != nil {
+			log.Fatalf("Failed to create indexes on %s: %v", collection, err)
+		}
+	}
 }
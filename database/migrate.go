@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Migration is one numbered, forward-only change to stored documents. Up must be safe to
+// re-run: if the process dies after Up but before the version is recorded, it runs again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// migrations in version order. Append new ones; never renumber or change one that has shipped.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "backfill missing status, accepted_by and created_at on orders",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			orders := db.Collection("orders")
+
+			_, err := orders.UpdateMany(ctx,
+				bson.M{"status": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"status": "NotAccepted"}},
+			)
+			if err != nil {
+				return err
+			}
+
+			_, err = orders.UpdateMany(ctx,
+				bson.M{"accepted_by": nil}, // missing or null
+				bson.M{"$set": bson.M{"accepted_by": primitive.NilObjectID}},
+			)
+			if err != nil {
+				return err
+			}
+
+			// An ObjectID carries its creation time, which is the best guess we have
+			_, err = orders.UpdateMany(ctx,
+				bson.M{"created_at": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "mark users created before email verification as verified",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// They already received their signup coins
+			_, err := db.Collection("users").UpdateMany(ctx,
+				bson.M{"email_verified": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"email_verified": true}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "give orders from before expiry existed a one hour expiry",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Measured from creation, so older open orders are closed and refunded by the next sweep
+			_, err := db.Collection("orders").UpdateMany(ctx,
+				bson.M{"expires_at": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{
+					"expires_at": bson.M{"$add": bson.A{"$created_at", int64(time.Hour / time.Millisecond)}},
+				}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "start the status history of existing orders with their creation",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Earlier status changes were never recorded, so creation is all we can vouch for
+			_, err := db.Collection("orders").UpdateMany(ctx,
+				bson.M{"history": bson.M{"$exists": false}},
+				mongo.Pipeline{{{Key: "$set", Value: bson.M{
+					"history": bson.A{bson.M{"from": "", "to": "NotAccepted", "by": "$placed_by", "at": "$created_at"}},
+				}}}},
+			)
+			return err
+		},
+	},
+	{
+		Version:     5,
+		Description: "copy the placer's hostel onto existing orders",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// Orders placed by a user who no longer exists get an empty hostel
+			cursor, err := db.Collection("orders").Aggregate(ctx, mongo.Pipeline{
+				{{Key: "$match", Value: bson.M{"hostel": bson.M{"$exists": false}}}},
+				{{Key: "$lookup", Value: bson.M{"from": "users", "localField": "placed_by", "foreignField": "_id", "as": "placer"}}},
+				{{Key: "$project", Value: bson.M{
+					"hostel": bson.M{"$ifNull": bson.A{bson.M{"$arrayElemAt": bson.A{"$placer.hostel", 0}}, ""}},
+				}}},
+				{{Key: "$merge", Value: bson.M{"into": "orders", "on": "_id", "whenMatched": "merge", "whenNotMatched": "discard"}}},
+			})
+			if err != nil {
+				return err
+			}
+			return cursor.Close(ctx)
+		},
+	},
+	{
+		Version:     6,
+		Description: "lower-case and trim user emails, which logins now look up that way",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			normalized := bson.M{"$toLower": bson.M{"$trim": bson.M{"input": "$email"}}}
+			return normalizeUserField(ctx, db.Collection("users"), "email", normalized)
+		},
+	},
+	{
+		Version:     7,
+		Description: "upper-case and trim enrollment numbers, which registration now stores that way",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// The unique index on enrollment is case-sensitive, so 21ucs001 and 21UCS001 could
+			// both have registered
+			normalized := bson.M{"$toUpper": bson.M{"$trim": bson.M{"input": "$enrollment"}}}
+			return normalizeUserField(ctx, db.Collection("users"), "enrollment", normalized)
+		},
+	},
+}
+
+const (
+	migrationsCollection = "schema_migrations"
+	migrationLockID      = "lock"
+	// migrationLockLease bounds how long a crashed instance can keep others from migrating
+	migrationLockLease = 10 * time.Minute
+)
+
+// migrationRecord marks one migration as applied. The lock lives in the same collection
+// under migrationLockID.
+type migrationRecord struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+}
+
+// Migrate applies, in order, every migration not yet recorded in schema_migrations.
+// Only one instance migrates at a time; the others wait for it and then find nothing to do.
+func Migrate(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), migrationLockLease)
+	defer cancel()
+
+	collection := db.Collection(migrationsCollection)
+
+	release, err := acquireMigrationLock(ctx, collection)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer release()
+
+	applied, err := appliedMigrations(ctx, collection)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		if err := m.Up(ctx, db); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+
+		record := migrationRecord{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		if _, err := collection.InsertOne(ctx, record); err != nil {
+			return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// normalizeUserField rewrites the string field of every user to the normalized expression.
+// Two accounts that normalize to the same value cannot both keep it, and the field is
+// uniquely indexed, so it first looks for such collisions and fails listing them; an
+// operator has to merge or rename those accounts before the migration can go on.
+func normalizeUserField(ctx context.Context, users *mongo.Collection, field string, normalized bson.M) error {
+	cursor, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{field: bson.M{"$type": "string", "$gt": ""}}}},
+		{{Key: "$group", Value: bson.M{"_id": normalized, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"_id": bson.M{"$gt": ""}, "count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var collisions []struct {
+		Value string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &collisions); err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		values := make([]string, len(collisions))
+		for i, c := range collisions {
+			values[i] = c.Value
+		}
+		return fmt.Errorf("several users share each of these %ss once normalized: %v", field, values)
+	}
+
+	_, err = users.UpdateMany(ctx,
+		bson.M{
+			field:   bson.M{"$type": "string"},
+			"$expr": bson.M{"$ne": bson.A{"$" + field, normalized}},
+		},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{field: normalized}}}},
+	)
+	return err
+}
+
+// acquireMigrationLock takes the lock, waiting while another instance holds an unexpired one.
+// The returned func releases it.
+func acquireMigrationLock(ctx context.Context, collection *mongo.Collection) (func(), error) {
+	owner := primitive.NewObjectID()
+
+	for {
+		// Matches only a lock that has expired. If the lock is held, the upsert tries to
+		// insert a second document with the same _id and fails with a duplicate key error.
+		now := time.Now()
+		filter := bson.M{
+			"_id":        migrationLockID,
+			"expires_at": bson.M{"$lt": now},
+		}
+		update := bson.M{
+			"$set": bson.M{"owner": owner, "expires_at": now.Add(migrationLockLease)},
+		}
+
+		_, err := collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		log.Println("Another instance is running migrations; waiting")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err := collection.DeleteOne(ctx, bson.M{"_id": migrationLockID, "owner": owner})
+		if err != nil {
+			log.Printf("failed to release migration lock: %v", err)
+		}
+	}, nil
+}
+
+func appliedMigrations(ctx context.Context, collection *mongo.Collection) (map[int]bool, error) {
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []migrationRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, record := range records {
+		applied[record.Version] = true
+	}
+	return applied, nil
+}
@@ -2,39 +2,44 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/suraj/nitabuddy/config"
 	"github.com/suraj/nitabuddy/models"
+	"github.com/suraj/nitabuddy/notify"
+	"github.com/suraj/nitabuddy/validation"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type AuthHandler struct {
-	userModel *models.UserModel
-	jwtSecret []byte
+	userModel       *models.UserModel
+	tokenModel      *models.TokenModel
+	resetModel      *models.PasswordResetModel
+	mailer          notify.Mailer
+	jwt             config.JWTConfig
+	campus          config.CampusConfig
+	verificationTTL time.Duration
 }
 
-func NewAuthHandler(userModel *models.UserModel, jwtSecret []byte) *AuthHandler {
+func NewAuthHandler(userModel *models.UserModel, tokenModel *models.TokenModel, resetModel *models.PasswordResetModel, mailer notify.Mailer, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		userModel: userModel,
-		jwtSecret: jwtSecret,
+		userModel:       userModel,
+		tokenModel:      tokenModel,
+		resetModel:      resetModel,
+		mailer:          mailer,
+		jwt:             cfg.JWT,
+		campus:          cfg.Campus,
+		verificationTTL: cfg.EmailVerificationTTL,
 	}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Email      string `json:"email"`
-		Password   string `json:"password"`
-		Name       string `json:"name"`
-		Enrollment string `json:"enrollment"`
-		Phone      string `json:"phone"`
-		Hostel     string `json:"hostel"`
-		Branch     string `json:"branch"`
-		Year       string `json:"year"`
-	}
+	var input validation.Registration
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -47,7 +52,32 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	input.Normalize()
+	if fieldErrors := input.Validate(h.campus); fieldErrors != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Please correct the highlighted fields",
+			"errors":  fieldErrors,
+			"token":   "",
+		})
+		return
+	}
+
 	user, err := h.userModel.Create(input.Email, input.Password, input.Name, input.Enrollment, input.Phone, input.Hostel, input.Branch, input.Year)
+	var duplicate *models.DuplicateError
+	if errors.As(err, &duplicate) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "An account with this " + duplicate.Field + " already exists",
+			"errors":  validation.FieldErrors{duplicate.Field: duplicate.Field + " is already registered"},
+			"token":   "",
+		})
+		return
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -59,7 +89,10 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := h.generateJWT(user.ID)
+	// A failed send is logged; the user can ask for another from /verify-email/resend
+	h.sendVerificationEmail(r.Context(), user)
+
+	tokenString, refreshToken, err := h.generateTokens(user)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -73,9 +106,11 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  true,
-		"message": "User Registered Successfully",
-		"token":   tokenString,
+		"status":        true,
+		"message":       "User Registered Successfully. Check your email to verify your account.",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.jwt.AccessTTL.Seconds()),
 	})
 
 }
@@ -98,7 +133,8 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.userModel.GetByEmail(input.Email)
+	// Emails are stored lower-cased since registration validates them
+	user, err := h.userModel.GetByEmail(strings.ToLower(strings.TrimSpace(input.Email)))
 	if err != nil || !h.userModel.VerifyPassword(user, input.Password) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusUnauthorized)
@@ -110,7 +146,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenString, err := h.generateJWT(user.ID)
+	tokenString, refreshToken, err := h.generateTokens(user)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -124,14 +160,39 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  true,
-		"message": "Login Successful",
-		"token":   tokenString,
+		"status":        true,
+		"message":       "Login Successful",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.jwt.AccessTTL.Seconds()),
 	})
 }
 
+// Logout revokes the presented access token and, if the body carries one, the refresh token of
+// this session. An invalid or missing access token is already unusable, so that still succeeds.
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	// JWT is stateless: Just ask client to discard the token
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(r.Body).Decode(&input) // body is optional
+
+	claims, err := h.parseToken(r)
+	if err == nil {
+		err = h.tokenModel.RevokeAccessToken(claims.jti, claims.userID, claims.expiresAt)
+		if err == nil && input.RefreshToken != "" {
+			err = h.tokenModel.RevokeRefreshToken(input.RefreshToken, claims.userID)
+		}
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": "Logout failed: " + err.Error(),
+				"status":  false,
+			})
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Logout Successful",
@@ -139,21 +200,141 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (h *AuthHandler) generateJWT(userID primitive.ObjectID) (string, error) {
+// LogoutAll signs the user out on every device: all access tokens issued so far stop
+// working and every refresh token is revoked.
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	if err := h.userModel.InvalidateSessions(userID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Logout failed: " + err.Error(),
+			"status":  false,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Logged out of all devices",
+		"status":  true,
+	})
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token.
+// The presented refresh token is spent; using it again revokes the whole chain.
+func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "refresh_token is required",
+			"token":   "",
+		})
+		return
+	}
+
+	userID, refreshToken, err := h.tokenModel.RotateRefreshToken(input.RefreshToken)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, models.ErrInvalidRefreshToken) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+			"token":   "",
+		})
+		return
+	}
+
+	user, err := h.userModel.GetUserByID(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "user not found",
+			"token":   "",
+		})
+		return
+	}
+
+	tokenString, err := h.generateJWT(user)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to generate token",
+			"token":   "",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        true,
+		"message":       "Token refreshed",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.jwt.AccessTTL.Seconds()),
+	})
+}
+
+// generateTokens issues a short-lived access token and starts a new refresh token chain.
+func (h *AuthHandler) generateTokens(user *models.User) (string, string, error) {
+	tokenString, err := h.generateJWT(user)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := h.tokenModel.IssueRefreshToken(user.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return tokenString, refreshToken, nil
+}
+
+func (h *AuthHandler) generateJWT(user *models.User) (string, error) {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"user_id": userID.Hex(),
-		"iat":     time.Now().Unix(), // gives new token at every login
-		// No expiration - Token Never Expires
+		"user_id": user.ID.Hex(),
+		"ver":     user.TokenVersion,
+		"jti":     primitive.NewObjectID().Hex(),
+		"iat":     now.Unix(), // gives new token at every login
+		"exp":     now.Add(h.jwt.AccessTTL).Unix(),
+		"iss":     h.jwt.Issuer,
+		"aud":     h.jwt.Audience,
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(h.jwtSecret)
+	return token.SignedString(h.jwt.Secret)
+}
+
+// accessClaims is what the server needs out of a verified access token.
+type accessClaims struct {
+	userID    primitive.ObjectID
+	jti       string
+	version   int
+	expiresAt time.Time
 }
 
-func (h *AuthHandler) GetUserIDFromToken(r *http.Request) (primitive.ObjectID, error) {
+// parseToken verifies the signature and standard claims of the bearer token.
+// It does not check revocation; authenticate does.
+func (h *AuthHandler) parseToken(r *http.Request) (*accessClaims, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return primitive.ObjectID{}, http.ErrNoCookie
+		return nil, errors.New("missing Authorization header")
 	}
 
 	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
@@ -162,22 +343,79 @@ func (h *AuthHandler) GetUserIDFromToken(r *http.Request) (primitive.ObjectID, e
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
-		return h.jwtSecret, nil
-	})
+		return h.jwt.Secret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(h.jwt.Issuer),
+		jwt.WithAudience(h.jwt.Audience),
+	)
 
 	if err != nil || !token.Valid {
-		return primitive.ObjectID{}, fmt.Errorf("invalid or expired token")
+		return nil, fmt.Errorf("invalid or expired token")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return primitive.ObjectID{}, fmt.Errorf("invalid claims")
+		return nil, fmt.Errorf("invalid claims")
 	}
 
 	userIDHex, ok := claims["user_id"].(string)
 	if !ok {
-		return primitive.ObjectID{}, fmt.Errorf("user_id not found in token")
+		return nil, fmt.Errorf("user_id not found in token")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userIDHex)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user_id in token")
+	}
+
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return nil, fmt.Errorf("jti not found in token")
+	}
+
+	version, ok := claims["ver"].(float64) // JSON numbers decode as float64
+	if !ok {
+		return nil, fmt.Errorf("ver not found in token")
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return nil, fmt.Errorf("invalid claims")
+	}
+
+	return &accessClaims{
+		userID:    userID,
+		jti:       jti,
+		version:   int(version),
+		expiresAt: exp.Time,
+	}, nil
+}
+
+// authenticate resolves the bearer token to its user: the token must be valid, not logged
+// out, and issued since the user last logged out of all devices.
+func (h *AuthHandler) authenticate(r *http.Request) (*models.User, error) {
+	claims, err := h.parseToken(r)
+	if err != nil {
+		return nil, err
+	}
+
+	revoked, err := h.tokenModel.IsAccessTokenRevoked(claims.jti)
+	if err != nil {
+		return nil, fmt.Errorf("could not check token: %v", err)
+	}
+	if revoked {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	user, err := h.userModel.GetUserByID(claims.userID)
+	if err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+	if user.TokenVersion != claims.version {
+		return nil, fmt.Errorf("token has been revoked")
 	}
 
-	return primitive.ObjectIDFromHex(userIDHex)
+	return user, nil
 }
@@ -0,0 +1,304 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/suraj/nitabuddy/config"
+	"github.com/suraj/nitabuddy/handlers"
+	"github.com/suraj/nitabuddy/models"
+	"github.com/suraj/nitabuddy/routes"
+)
+
+// recordingMailer keeps every email so tests can read the tokens sent to users.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent map[string][]string // bodies by recipient, oldest first
+}
+
+func (m *recordingMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent[to] = append(m.sent[to], body)
+	return nil
+}
+
+func (m *recordingMailer) last(to string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if bodies := m.sent[to]; len(bodies) > 0 {
+		return bodies[len(bodies)-1]
+	}
+	return ""
+}
+
+// testServer is the whole API on the in-memory store, wired the way main.go does it.
+type testServer struct {
+	t      *testing.T
+	router *mux.Router
+	mailer *recordingMailer
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret-test-secret-test-secret")
+
+	cfg := config.Load()
+	db := models.NewMemoryDB()
+	userStore := models.NewMemoryUserStore(db)
+	orderStore := models.NewMemoryOrderStore(db)
+	refreshTokenStore := models.NewMemoryRefreshTokenStore(db)
+
+	rewardsModel := models.NewRewardsModel(models.NewMemoryRewardsStore(db), models.NewMemoryLedgerStore(db), db)
+	userModel := models.NewUserModel(userStore, orderStore, rewardsModel, refreshTokenStore, db)
+	shopModel := models.NewShopModel(models.NewMemoryShopStore(db), cfg.Campus.Timezone)
+	orderModel := models.NewOrderModel(orderStore, userStore, rewardsModel, shopModel, db, models.OrderExpiry{
+		Default: cfg.Orders.DefaultTTL,
+		Max:     cfg.Orders.MaxTTL,
+	}, models.ReleasePolicy{
+		Free:    cfg.Orders.FreeReleases,
+		Window:  cfg.Orders.ReleaseWindow,
+		Penalty: cfg.Orders.ReleasePenalty,
+	}, models.NewHostelMap(cfg.Campus.HostelDistances))
+	tokenModel := models.NewTokenModel(refreshTokenStore, models.NewMemoryRevocationStore(db), cfg.JWT.RefreshTTL)
+	resetModel := models.NewPasswordResetModel(models.NewMemoryPasswordResetStore(db), userStore, refreshTokenStore, db, cfg.PasswordResetTTL)
+
+	mailer := &recordingMailer{sent: make(map[string][]string)}
+	router := mux.NewRouter()
+	routes.Setup(router,
+		handlers.NewAuthHandler(userModel, tokenModel, resetModel, mailer, cfg),
+		handlers.NewOrderHandler(orderModel, userModel, mailer),
+		handlers.NewRewardsHandler(rewardsModel),
+		handlers.NewShopHandler(shopModel, cfg),
+	)
+
+	return &testServer{t: t, router: router, mailer: mailer}
+}
+
+// do sends a JSON request, with token as the bearer token if it is not empty, and
+// decodes the JSON response.
+func (s *testServer) do(method, path, token string, body interface{}) (int, map[string]interface{}) {
+	s.t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatalf("encode %s %s: %v", method, path, err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var resp map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		s.t.Fatalf("%s %s: response is not JSON: %q", method, path, rec.Body.String())
+	}
+	return rec.Code, resp
+}
+
+func registration(email, phone, enrollment, hostel string) map[string]string {
+	return map[string]string{
+		"email":      email,
+		"password":   "passw0rd",
+		"name":       "Student " + phone,
+		"phone":      phone,
+		"enrollment": enrollment,
+		"hostel":     hostel,
+		"branch":     "CSE",
+		"year":       "3",
+	}
+}
+
+var verificationToken = regexp.MustCompile(`Verification token:\n(\S+)`)
+
+// verifiedUser registers a user, confirms their email and returns their access token.
+func (s *testServer) verifiedUser(email, phone, enrollment, hostel string) string {
+	s.t.Helper()
+
+	code, resp := s.do("POST", "/register", "", registration(email, phone, enrollment, hostel))
+	if code != http.StatusCreated && code != http.StatusOK {
+		s.t.Fatalf("register %s: %d %v", email, code, resp)
+	}
+	token := resp["token"].(string)
+
+	match := verificationToken.FindStringSubmatch(s.mailer.last(email))
+	if match == nil {
+		s.t.Fatalf("no verification email for %s", email)
+	}
+	if code, resp := s.do("POST", "/verify-email", "", map[string]string{"token": match[1]}); code != http.StatusOK {
+		s.t.Fatalf("verify %s: %d %v", email, code, resp)
+	}
+
+	return token
+}
+
+func (s *testServer) coins(token string) (coins, held float64) {
+	s.t.Helper()
+
+	code, resp := s.do("GET", "/rewards", token, nil)
+	if code != http.StatusOK {
+		s.t.Fatalf("rewards: %d %v", code, resp)
+	}
+	return resp["coins"].(float64), resp["held"].(float64)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newTestServer(t)
+
+	code, resp := s.do("POST", "/register", "", registration("asha@nita.ac.in", "9000000001", "21UCS001", "BH1"))
+	if code != http.StatusCreated && code != http.StatusOK {
+		t.Fatalf("register: %d %v", code, resp)
+	}
+
+	code, resp = s.do("POST", "/register", "", registration("Asha@nita.ac.in", "9000000002", "21UCS002", "BH1"))
+	if code != http.StatusConflict {
+		t.Errorf("register with a taken email: got %d %v, want 409", code, resp)
+	}
+
+	code, _ = s.do("POST", "/login", "", map[string]string{"email": "asha@nita.ac.in", "password": "wrong-password"})
+	if code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password: got %d, want 401", code)
+	}
+
+	code, resp = s.do("POST", "/login", "", map[string]string{"email": " ASHA@nita.ac.in ", "password": "passw0rd"})
+	if code != http.StatusOK {
+		t.Fatalf("login: %d %v", code, resp)
+	}
+	token, _ := resp["token"].(string)
+	if token == "" {
+		t.Fatalf("login returned no token: %v", resp)
+	}
+
+	if code, resp := s.do("GET", "/profile", token, nil); code != http.StatusOK {
+		t.Errorf("profile with the login token: %d %v", code, resp)
+	}
+	if code, _ := s.do("GET", "/profile", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("profile without a token: got %d, want 401", code)
+	}
+}
+
+func TestOrderLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	placer := s.verifiedUser("placer@nita.ac.in", "9000000011", "21UCS011", "BH1")
+	runner := s.verifiedUser("runner@nita.ac.in", "9000000012", "21UCS012", "BH2")
+	other := s.verifiedUser("other@nita.ac.in", "9000000013", "21UCS013", "BH3")
+
+	code, resp := s.do("POST", "/order", placer, map[string]interface{}{"store": "Amul", "order_details": "2 milk"})
+	if code != http.StatusCreated && code != http.StatusOK {
+		t.Fatalf("place order: %d %v", code, resp)
+	}
+	if coins, held := s.coins(placer); coins != models.SignupBonus || held != models.OrderFee {
+		t.Errorf("placer after placing: coins %v held %v, want %d held %d", coins, held, models.SignupBonus, models.OrderFee)
+	}
+
+	code, resp = s.do("GET", "/myOrders", placer, nil)
+	orders, _ := resp["orders"].([]interface{})
+	if code != http.StatusOK || len(orders) != 1 {
+		t.Fatalf("my orders: %d %v", code, resp)
+	}
+	order := orders[0].(map[string]interface{})
+	id, otp := order["id"].(string), order["otp"].(string)
+
+	if code, resp := s.do("PUT", "/acceptOrder/"+id, placer, nil); code == http.StatusOK {
+		t.Errorf("placer accepted their own order: %v", resp)
+	}
+	if code, resp := s.do("PUT", "/acceptOrder/"+id, runner, nil); code != http.StatusOK {
+		t.Fatalf("accept: %d %v", code, resp)
+	}
+	if code, resp := s.do("PUT", "/acceptOrder/"+id, other, nil); code != http.StatusConflict {
+		t.Errorf("second accept: got %d %v, want 409", code, resp)
+	}
+
+	complete := map[string]string{"order_id": id, "otp": "wrong"}
+	if code, _ := s.do("PUT", "/completeOrder", runner, complete); code == http.StatusOK {
+		t.Errorf("completed with a wrong OTP")
+	}
+	complete["otp"] = otp
+	if code, resp := s.do("PUT", "/completeOrder", other, complete); code != http.StatusForbidden {
+		t.Errorf("complete by a non-runner: got %d %v, want 403", code, resp)
+	}
+	if code, resp := s.do("PUT", "/completeOrder", runner, complete); code != http.StatusOK {
+		t.Fatalf("complete: %d %v", code, resp)
+	}
+	if code, resp := s.do("PUT", "/completeOrder", runner, complete); code != http.StatusConflict {
+		t.Errorf("second complete: got %d %v, want 409", code, resp)
+	}
+
+	if coins, held := s.coins(placer); coins != models.SignupBonus-models.OrderFee || held != 0 {
+		t.Errorf("placer after completion: coins %v held %v", coins, held)
+	}
+	if coins, held := s.coins(runner); coins != models.SignupBonus+models.OrderFee || held != 0 {
+		t.Errorf("runner after completion: coins %v held %v", coins, held)
+	}
+
+	// A completed order is closed, which is not the same as losing the race for it
+	if code, resp := s.do("PUT", "/acceptOrder/"+id, other, nil); code != http.StatusGone {
+		t.Errorf("accepting a completed order: got %d %v, want 410", code, resp)
+	}
+
+	rate := map[string]interface{}{"stars": 4, "comment": "quick"}
+	if code, resp := s.do("PUT", "/rateOrder/"+id, other, rate); code != http.StatusForbidden {
+		t.Errorf("rating by a non-party: got %d %v, want 403", code, resp)
+	}
+	if code, resp := s.do("PUT", "/rateOrder/"+id, placer, rate); code != http.StatusOK {
+		t.Fatalf("rate: %d %v", code, resp)
+	}
+	if code, resp := s.do("PUT", "/rateOrder/"+id, placer, rate); code != http.StatusConflict {
+		t.Errorf("second rating: got %d %v, want 409", code, resp)
+	}
+
+	_, resp = s.do("GET", "/profile", runner, nil)
+	runnerID := resp["user"].(map[string]interface{})["id"].(string)
+	code, resp = s.do("GET", "/profile/"+runnerID, other, nil)
+	if code != http.StatusOK {
+		t.Fatalf("runner's profile: %d %v", code, resp)
+	}
+	ratings := resp["user"].(map[string]interface{})["ratings"].(map[string]interface{})
+	if asRunner := ratings["as_runner"].(map[string]interface{}); asRunner["average"] != 4.0 || asRunner["count"] != 1.0 {
+		t.Errorf("runner's ratings as a runner: %v, want average 4 over 1", asRunner)
+	}
+}
+
+func TestRewards(t *testing.T) {
+	s := newTestServer(t)
+
+	if code, _ := s.do("GET", "/rewards", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("rewards without a token: got %d, want 401", code)
+	}
+
+	// No coins until the email is verified
+	code, resp := s.do("POST", "/register", "", registration("new@nita.ac.in", "9000000021", "21UCS021", "BH1"))
+	if code != http.StatusCreated && code != http.StatusOK {
+		t.Fatalf("register: %d %v", code, resp)
+	}
+	if coins, _ := s.coins(resp["token"].(string)); coins != 0 {
+		t.Errorf("unverified user has %v coins, want 0", coins)
+	}
+
+	token := s.verifiedUser("verified@nita.ac.in", "9000000022", "21UCS022", "BH1")
+	if coins, held := s.coins(token); coins != models.SignupBonus || held != 0 {
+		t.Errorf("verified user: coins %v held %v, want %d held 0", coins, held, models.SignupBonus)
+	}
+
+	code, resp = s.do("GET", "/rewards/history", token, nil)
+	entries, _ := resp["entries"].([]interface{})
+	if code != http.StatusOK || len(entries) != 1 {
+		t.Fatalf("history: %d %v", code, resp)
+	}
+	if reason := entries[0].(map[string]interface{})["reason"]; reason != models.ReasonSignupBonus {
+		t.Errorf("history entry reason = %v, want %s", reason, models.ReasonSignupBonus)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/suraj/nitabuddy/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type contextKey int
+
+const (
+	userIDKey contextKey = iota
+	roleKey
+	emailVerifiedKey
+)
+
+// RequireAuth rejects requests without a valid access token with a 401 and otherwise
+// makes the caller's ID and role available through UserIDFromContext and RoleFromContext.
+func (h *AuthHandler) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := h.authenticate(r)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":  false,
+				"message": "Unauthorized: " + err.Error(),
+			})
+			return
+		}
+
+		role := user.Role
+		if role == "" {
+			role = models.RoleStudent
+		}
+
+		ctx := context.WithValue(r.Context(), userIDKey, user.ID)
+		ctx = context.WithValue(ctx, roleKey, role)
+		ctx = context.WithValue(ctx, emailVerifiedKey, user.EmailVerified)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireVerifiedEmail rejects callers who have not verified their email yet with a 403.
+// It must run after RequireAuth.
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if verified, _ := r.Context().Value(emailVerifiedKey).(bool); !verified {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":  false,
+				"message": "Verify your email address to use this feature",
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UserIDFromContext returns the authenticated caller. Only valid behind RequireAuth.
+func UserIDFromContext(ctx context.Context) primitive.ObjectID {
+	userID, _ := ctx.Value(userIDKey).(primitive.ObjectID)
+	return userID
+}
+
+// RoleFromContext returns the authenticated caller's role. Only valid behind RequireAuth.
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleKey).(string)
+	return role
+}
+
+// RequireRole rejects callers without the given role with a 403. It must run after RequireAuth.
+func RequireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if RoleFromContext(r.Context()) != role {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"status":  false,
+					"message": "You are not allowed to do this",
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
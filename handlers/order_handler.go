@@ -1,43 +1,47 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/suraj/nitabuddy/models"
+	"github.com/suraj/nitabuddy/notify"
+	"github.com/suraj/nitabuddy/validation"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type OrderHandler struct {
-	orderModel  *models.OrderModel
-	authHandler *AuthHandler // Add this field
+	orderModel *models.OrderModel
+	userModel  *models.UserModel
+	mailer     notify.Mailer
 }
 
-func NewOrderHandler(orderModel *models.OrderModel, authHandler *AuthHandler) *OrderHandler {
+func NewOrderHandler(orderModel *models.OrderModel, userModel *models.UserModel, mailer notify.Mailer) *OrderHandler {
 	return &OrderHandler{
-		orderModel:  orderModel,
-		authHandler: authHandler, // Initialize it
+		orderModel: orderModel,
+		userModel:  userModel,
+		mailer:     mailer,
 	}
 }
 
 func (h *OrderHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 
-	// Check for valid user - USE authHandler instead of utils
-	userID, err := h.authHandler.GetUserIDFromToken(r)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"message": "Unauthorized: " + err.Error(),
-			"status":  false,
-		})
-		return
-	}
+	userID := UserIDFromContext(r.Context())
 
 	var input struct {
-		Store        string `json:"store"`
-		OrderDetails string `json:"order_details"`
+		StoreID          string `json:"store_id"` // a store from GET /stores
+		Store            string `json:"store"`    // free text, for clients without the catalog
+		OrderDetails     string `json:"order_details"`
+		ExpiresInMinutes int    `json:"expires_in_minutes"` // optional, the store's default otherwise
+		validation.OrderItems
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -50,10 +54,50 @@ func (h *OrderHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = h.orderModel.CreateOrder(input.Store, input.OrderDetails, userID)
+	input.OrderItems.Normalize()
+	if fieldErrors := input.OrderItems.Validate(); fieldErrors != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Please correct the highlighted fields",
+			"errors":  fieldErrors,
+			"status":  false,
+		})
+		return
+	}
+
+	order := models.NewOrder{
+		Store:        input.Store,
+		OrderDetails: input.OrderDetails,
+		Items:        input.Items,
+		MaxSpend:     input.MaxSpend,
+		ExpiresIn:    time.Duration(input.ExpiresInMinutes) * time.Minute,
+	}
+	if input.StoreID != "" {
+		storeID, err := primitive.ObjectIDFromHex(input.StoreID)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"message": "Invalid store ID",
+				"status":  false,
+			})
+			return
+		}
+		order.StoreID = storeID
+	}
+
+	_, err := h.orderModel.CreateOrder(userID, order)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrDuplicate), errors.Is(err, models.ErrShopClosed):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"message": err.Error(),
 			"status":  false,
@@ -69,29 +113,37 @@ func (h *OrderHandler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
 
 }
 
+// FetchOtherOrders returns one page of the feed, oldest first by default. With
+// sort=nearby, orders from the caller's own and nearby hostels come first.
 func (h *OrderHandler) FetchOtherOrders(w http.ResponseWriter, r *http.Request) {
-	userID, err := h.authHandler.GetUserIDFromToken(r)
+	userID := UserIDFromContext(r.Context())
 
+	query, status, err := parseOrderQuery(r, false)
+	if err == nil && status != "" && status != models.StatusNotAccepted {
+		err = errors.New("the feed only lists orders that are " + models.StatusNotAccepted)
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Unauthorized " + err.Error(),
-			"orders":  []interface{}{},
+			"status":      false,
+			"message":     err.Error(),
+			"orders":      []interface{}{},
+			"next_cursor": nil,
 		})
 		return
 	}
 
 	// Fetch orders from DB
-	orders, err := h.orderModel.GetOtherIncompleteOrders(userID)
+	orders, next, err := h.orderModel.GetOtherIncompleteOrders(userID, query)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Failed to fetch Requests " + err.Error(),
-			"orders":  []interface{}{},
+			"status":      false,
+			"message":     "Failed to fetch Requests " + err.Error(),
+			"orders":      []interface{}{},
+			"next_cursor": nil,
 		})
 		return
 	}
@@ -102,37 +154,45 @@ func (h *OrderHandler) FetchOtherOrders(w http.ResponseWriter, r *http.Request)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  true,
-		"message": "Requests fetched",
-		"orders":  orders,
+		"status":      true,
+		"message":     "Requests fetched",
+		"orders":      models.ViewOrdersFor(orders, userID),
+		"next_cursor": cursorString(next),
 	})
-
 }
 
+// FetchMyOrders returns one page of the caller's orders, newest first by default.
 func (h *OrderHandler) FetchMyOrders(w http.ResponseWriter, r *http.Request) {
 
-	userID, err := h.authHandler.GetUserIDFromToken(r)
+	userID := UserIDFromContext(r.Context())
 
+	// Cancelled orders are left out unless asked for with ?status=Cancelled
+	query, status, err := parseOrderQuery(r, true)
+	if err == nil && query.Nearby {
+		err = errors.New("sort=nearby is only supported by the feed")
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Unauthorized " + err.Error(),
-			"orders":  []interface{}{},
+			"status":      false,
+			"message":     err.Error(),
+			"orders":      []interface{}{},
+			"next_cursor": nil,
 		})
 		return
 	}
 
 	// Fetch orders from DB
-	orders, err := h.orderModel.GetOrdersByUserID(userID)
+	orders, next, err := h.orderModel.GetOrdersByUserID(userID, status, query)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Failed to fetch Requests " + err.Error(),
-			"orders":  []interface{}{},
+			"status":      false,
+			"message":     "Failed to fetch Requests " + err.Error(),
+			"orders":      []interface{}{},
+			"next_cursor": nil,
 		})
 		return
 	}
@@ -143,30 +203,81 @@ func (h *OrderHandler) FetchMyOrders(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  true,
-		"message": "Requests fetched",
-		"orders":  orders,
+		"status":      true,
+		"message":     "Requests fetched",
+		"orders":      models.ViewOrdersFor(orders, userID),
+		"next_cursor": cursorString(next),
 	})
 }
 
 func (h *OrderHandler) CancelMyOrder(w http.ResponseWriter, r *http.Request) {
 
-	userID, err := h.authHandler.GetUserIDFromToken(r)
+	userID := UserIDFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	orderIDstr := vars["id"]
+	orderID, err := primitive.ObjectIDFromHex(orderIDstr)
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
-			"message": "Unauthorized: " + err.Error(),
+			"message": "Invalid Request ID",
 		})
 		return
 	}
 
-	vars := mux.Vars(r)
-	orderIDstr := vars["id"]
-	orderID, err := primitive.ObjectIDFromHex(orderIDstr)
+	// The body is optional; older clients send none
+	var input struct {
+		Reason        string `json:"reason"`
+		AcceptPenalty bool   `json:"accept_penalty"` // cancel an accepted order without waiting for the runner
+	}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	cancelled, err := h.orderModel.CancelOrder(userID, orderID, input.Reason, input.AcceptPenalty)
 
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotPlacer):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Could not cancel Request: " + err.Error(),
+		})
+		return
+	}
+
+	if !cancelled {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  true,
+			"message": "Cancellation requested. The runner has to agree, or cancel with accept_penalty to pay them the fee.",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Request cancelled",
+	})
+}
+
+// AgreeCancelOrder lets the runner accept the placer's request to cancel.
+func (h *OrderHandler) AgreeCancelOrder(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -177,11 +288,19 @@ func (h *OrderHandler) CancelMyOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.orderModel.CancelOrder(userID, orderID)
-
+	err = h.orderModel.AgreeToCancel(userID, orderID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotRunner):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrNoCancelRequest), errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
 			"message": "Could not cancel Request: " + err.Error(),
@@ -192,24 +311,84 @@ func (h *OrderHandler) CancelMyOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  true,
-		"message": "Request cancelled and Deleted",
+		"message": "Request cancelled",
 	})
 }
 
-func (h *OrderHandler) AcceptOrder(w http.ResponseWriter, r *http.Request) {
+// ReleaseOrder lets the runner hand an accepted order back to the feed. The placer is told by email.
+func (h *OrderHandler) ReleaseOrder(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
+		})
+		return
+	}
 
-	userID, err := h.authHandler.GetUserIDFromToken(r)
+	// The body is optional
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&input)
 
+	order, err := h.orderModel.ReleaseOrder(userID, orderID, input.Reason)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotRunner):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrReleaseLimit), errors.Is(err, models.ErrReleasePenalty),
+			errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
-			"message": "Unauthorized: " + err.Error(),
+			"message": "Could not release Request: " + err.Error(),
 		})
 		return
 	}
 
+	// The order is already back in the feed, so a failed email must not fail the release
+	h.notifyReleased(r.Context(), order, strings.TrimSpace(input.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Request released",
+	})
+}
+
+func (h *OrderHandler) notifyReleased(ctx context.Context, order *models.Order, reason string) {
+	placer, err := h.userModel.GetUserByID(order.PlacedBy)
+	if err != nil {
+		log.Printf("failed to notify placer of released order %s: %v", order.OrderID.Hex(), err)
+		return
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nThe runner who accepted your order %s from %s can no longer deliver it. It is open again for other runners to accept.",
+		placer.Name, order.CustomOrderID, order.Store)
+	if reason != "" {
+		body += fmt.Sprintf("\n\nReason given: %s", reason)
+	}
+
+	if err := h.mailer.Send(ctx, placer.Email, "Your NITA Buddy order is open again", body); err != nil {
+		log.Printf("failed to notify placer of released order %s: %v", order.OrderID.Hex(), err)
+	}
+}
+
+func (h *OrderHandler) AcceptOrder(w http.ResponseWriter, r *http.Request) {
+
+	userID := UserIDFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	orderIDstr := vars["id"]
 	orderId, err := primitive.ObjectIDFromHex(orderIDstr)
@@ -228,7 +407,18 @@ func (h *OrderHandler) AcceptOrder(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, models.ErrOrderAlreadyTaken):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, models.ErrOrderExpired), errors.Is(err, models.ErrOrderClosed):
+			w.WriteHeader(http.StatusGone)
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrOwnOrder):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
 			"message": "can't Accept Request: " + err.Error(),
@@ -243,28 +433,37 @@ func (h *OrderHandler) AcceptOrder(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// FetchAcceptedOrders returns one page of the orders the caller accepted, oldest first by
+// default. Without a status filter only the orders still in progress are listed.
 func (h *OrderHandler) FetchAcceptedOrders(w http.ResponseWriter, r *http.Request) {
 
-	userID, err := h.authHandler.GetUserIDFromToken(r)
+	userID := UserIDFromContext(r.Context())
+
+	query, status, err := parseOrderQuery(r, false)
+	if err == nil && query.Nearby {
+		err = errors.New("sort=nearby is only supported by the feed")
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Unauthorized" + err.Error(),
-			"orders":  []interface{}{},
+			"status":      false,
+			"message":     err.Error(),
+			"orders":      []interface{}{},
+			"next_cursor": nil,
 		})
 		return
 	}
 
-	orders, err := h.orderModel.GetAcceptedOrders(userID)
+	orders, next, err := h.orderModel.GetAcceptedOrders(userID, status, query)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Failed to fetch Requests " + err.Error(),
-			"orders":  []interface{}{},
+			"status":      false,
+			"message":     "Failed to fetch Requests " + err.Error(),
+			"orders":      []interface{}{},
+			"next_cursor": nil,
 		})
 		return
 	}
@@ -275,29 +474,199 @@ func (h *OrderHandler) FetchAcceptedOrders(w http.ResponseWriter, r *http.Reques
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  true,
-		"message": "Requests fetched",
-		"orders":  orders,
+		"status":      true,
+		"message":     "Requests fetched",
+		"orders":      models.ViewOrdersFor(orders, userID),
+		"next_cursor": cursorString(next),
 	})
 }
 
 func (h *OrderHandler) CompleteOrder(w http.ResponseWriter, r *http.Request) {
-	userID, err := h.authHandler.GetUserIDFromToken(r)
+	userID := UserIDFromContext(r.Context())
+
+	var input struct {
+		OrderID    string `json:"order_id"`
+		OTP        string `json:"otp"`
+		BillAmount *int64 `json:"bill_amount_paise"` // optional only for free-text orders without a max spend
+		ReceiptRef string `json:"receipt_ref"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	orderObjectID, err := primitive.ObjectIDFromHex(input.OrderID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
+		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
-			"message": "Unauthorized: " + err.Error(),
+			"message": "Invalid Order ID",
+		})
+		return
+	}
+
+	var bill *models.Bill
+	if input.BillAmount != nil {
+		bill = &models.Bill{Amount: *input.BillAmount, ReceiptRef: input.ReceiptRef}
+	}
+
+	err = h.orderModel.CompleteOrder(userID, orderObjectID, input.OTP, bill)
+	if errors.Is(err, models.ErrBillRequired) || errors.Is(err, models.ErrOverMaxSpend) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Please correct the highlighted fields",
+			"errors":  validation.FieldErrors{"bill_amount_paise": err.Error()},
+		})
+		return
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrOrderCompleted):
+			w.WriteHeader(http.StatusConflict)
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotRunner):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Order completed successfully. Rewards updated.",
+	})
+}
+
+func (h *OrderHandler) PickUpOrder(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
+		})
+		return
+	}
+
+	err = h.orderModel.PickUpOrder(userID, orderID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotRunner):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Order marked as picked up",
+	})
+}
+
+func (h *OrderHandler) DisputeOrder(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
 		})
 		return
 	}
 
 	var input struct {
-		OrderID string `json:"order_id"`
-		OTP     string `json:"otp"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid input: " + err.Error(),
+		})
+		return
 	}
 
+	err = h.orderModel.DisputeOrder(userID, orderID, input.Reason)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotOrderParty):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrInvalidTransition), errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Dispute raised",
+	})
+}
+
+// ConfirmSettlement lets the placer accept the bill the runner submitted on completion.
+func (h *OrderHandler) ConfirmSettlement(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
+		})
+		return
+	}
+
+	var input struct {
+		PaidVia string `json:"paid_via"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -308,21 +677,134 @@ func (h *OrderHandler) CompleteOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	orderObjectID, err := primitive.ObjectIDFromHex(input.OrderID)
+	settlement, err := h.orderModel.ConfirmSettlement(userID, orderID, input.PaidVia)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotPlacer):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrOrderNotCompleted), errors.Is(err, models.ErrNoSettlement),
+			errors.Is(err, models.ErrSettlementDone):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     true,
+		"message":    "Settlement confirmed",
+		"settlement": settlement,
+	})
+}
+
+// RateOrder lets either party of a completed order rate the other, once.
+func (h *OrderHandler) RateOrder(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
-			"message": "Invalid Order ID",
+			"message": "Invalid Request ID",
+		})
+		return
+	}
+
+	var input struct {
+		Stars   int    `json:"stars"`
+		Comment string `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	rating, err := h.orderModel.RateOrder(userID, orderID, input.Stars, input.Comment)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotOrderParty):
+			w.WriteHeader(http.StatusForbidden)
+		case errors.Is(err, models.ErrOrderNotCompleted), errors.Is(err, models.ErrAlreadyRated),
+			errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
 		})
 		return
 	}
 
-	err = h.orderModel.CompleteOrder(userID, orderObjectID, input.OTP)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Rating saved",
+		"rating":  rating,
+	})
+}
+
+// ResolveDispute is the admin's ruling on a disputed order: it becomes Completed or
+// Cancelled, and the placer's fee is paid or refunded to match.
+func (h *OrderHandler) ResolveDispute(w http.ResponseWriter, r *http.Request) {
+	adminID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
+		})
+		return
+	}
+
+	var input struct {
+		Resolution string `json:"resolution"` // Completed or Cancelled
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid input: " + err.Error(),
+		})
+		return
+	}
+
+	err = h.orderModel.ResolveDispute(adminID, orderID, input.Resolution, input.Reason)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrOrderNotDisputed), errors.Is(err, models.ErrOrderStatusChanged):
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
 			"message": err.Error(),
@@ -333,6 +815,153 @@ func (h *OrderHandler) CompleteOrder(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  true,
-		"message": "Order completed successfully. Rewards updated.",
+		"message": "Dispute resolved, order is now " + input.Resolution,
+	})
+}
+
+// FetchOrder returns a single order with its parties' profiles and, for them, its history.
+func (h *OrderHandler) FetchOrder(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
+			"order":   nil,
+		})
+		return
+	}
+
+	order, err := h.orderModel.GetOrderDetail(userID, orderID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotOrderParty):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+			"order":   nil,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Order fetched",
+		"order":   order,
+	})
+}
+
+func (h *OrderHandler) FetchOrderHistory(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	orderID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid Request ID",
+			"history": []interface{}{},
+		})
+		return
+	}
+
+	history, err := h.orderModel.GetOrderHistory(userID, orderID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, models.ErrNotOrderParty):
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+			"history": []interface{}{},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "History fetched",
+		"history": history,
 	})
 }
+
+// defaultPageSize applies when a client pages with after but does not say how far.
+const defaultPageSize = 20
+
+// parseOrderQuery reads the list parameters shared by the order lists: limit, after (the
+// next_cursor of the previous page), sort (created_at, -created_at or nearby), store,
+// hostel and status. newest is the endpoint's default sort. Without limit or after the
+// whole list comes back in one go, as it did for clients written before paging.
+func parseOrderQuery(r *http.Request, newest bool) (models.OrderQuery, string, error) {
+	values := r.URL.Query()
+	query := models.OrderQuery{
+		Store:  strings.TrimSpace(values.Get("store")),
+		Hostel: strings.TrimSpace(values.Get("hostel")),
+		Newest: newest,
+	}
+
+	if values.Get("after") != "" {
+		query.Limit = defaultPageSize
+	}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return query, "", errors.New("limit must be between 1 and 100")
+		}
+		query.Limit = n
+	}
+
+	if v := values.Get("after"); v != "" {
+		cursor, err := models.ParseOrderCursor(v)
+		if err != nil {
+			return query, "", err
+		}
+		query.After = cursor
+	}
+
+	switch values.Get("sort") {
+	case "":
+	case "created_at":
+		query.Newest = false
+	case "-created_at":
+		query.Newest = true
+	case "nearby":
+		query.Nearby, query.Newest = true, false
+	default:
+		return query, "", errors.New("sort must be created_at, -created_at or nearby")
+	}
+
+	status := values.Get("status")
+	if status != "" && !models.IsOrderStatus(status) {
+		return query, "", errors.New("Unknown status " + status)
+	}
+
+	return query, status, nil
+}
+
+// cursorString encodes the next page's cursor, or gives nil on the last page.
+func cursorString(cursor *models.OrderCursor) interface{} {
+	if cursor == nil {
+		return nil
+	}
+	return cursor.String()
+}
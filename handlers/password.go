@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/suraj/nitabuddy/models"
+	"github.com/suraj/nitabuddy/validation"
+)
+
+// ForgotPassword mails a reset token to the address, if an account has it. The response is
+// the same either way so the endpoint cannot be used to find out who is registered.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || strings.TrimSpace(input.Email) == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "email is required",
+		})
+		return
+	}
+
+	raw, user, err := h.resetModel.Issue(strings.ToLower(strings.TrimSpace(input.Email)))
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to start password reset: " + err.Error(),
+		})
+		return
+	}
+
+	if err == nil {
+		body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your NITA Buddy account. If it was you, use this token:\n%s\n\nIt expires in %s and works once. If it was not you, ignore this email.",
+			user.Name, raw, h.resetModel.TTL())
+
+		if err := h.mailer.Send(r.Context(), user.Email, "Reset your NITA Buddy password", body); err != nil {
+			log.Printf("failed to send password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "If an account exists for that email, a reset token has been sent to it",
+	})
+}
+
+// ResetPassword spends a reset token, sets the new password and logs the user out everywhere.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input validation.PasswordReset
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if fieldErrors := input.Validate(); fieldErrors != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Please correct the highlighted fields",
+			"errors":  fieldErrors,
+		})
+		return
+	}
+
+	_, err := h.resetModel.Reset(input.Token, input.NewPassword)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, models.ErrInvalidResetToken) {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Password reset. Please log in with your new password.",
+	})
+}
+
+// ChangePassword replaces the caller's password. Every other session is ended; the caller
+// gets a fresh pair of tokens so this device stays logged in.
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	var input validation.PasswordChange
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+			"token":   "",
+		})
+		return
+	}
+
+	if fieldErrors := input.Validate(); fieldErrors != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Please correct the highlighted fields",
+			"errors":  fieldErrors,
+			"token":   "",
+		})
+		return
+	}
+
+	err := h.userModel.ChangePassword(userID, input.OldPassword, input.NewPassword)
+	if errors.Is(err, models.ErrWrongPassword) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Please correct the highlighted fields",
+			"errors":  validation.FieldErrors{"old_password": err.Error()},
+			"token":   "",
+		})
+		return
+	}
+
+	var user *models.User
+	if err == nil {
+		user, err = h.userModel.GetUserByID(userID)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to change password: " + err.Error(),
+			"token":   "",
+		})
+		return
+	}
+
+	tokenString, refreshToken, err := h.generateTokens(user)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Password changed, but failed to generate token. Please log in again.",
+			"token":   "",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":        true,
+		"message":       "Password changed. You have been logged out of all other devices.",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.jwt.AccessTTL.Seconds()),
+	})
+}
@@ -2,44 +2,35 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/suraj/nitabuddy/models"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type RewardsHandler struct {
 	rewardsModel *models.RewardsModel
-	authHandler  *AuthHandler // Add this field
 }
 
-func NewRewardsHandler(rewardsModel *models.RewardsModel, authHandler *AuthHandler) *RewardsHandler {
+func NewRewardsHandler(rewardsModel *models.RewardsModel) *RewardsHandler {
 	return &RewardsHandler{
 		rewardsModel: rewardsModel,
-		authHandler:  authHandler, // Initialize it
 	}
 }
 
 func (h *RewardsHandler) FetchRewardsByID(w http.ResponseWriter, r *http.Request) {
 
-	userID, err := h.authHandler.GetUserIDFromToken(r) // Use authHandler instead of utils
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Unauthorized: " + err.Error(),
-			"coins":   0,
-		})
-		return
-	}
+	userID := UserIDFromContext(r.Context())
 
 	reward, err := h.rewardsModel.GetRewardsByUserID(userID)
 	if err != nil {
 
 		w.Header().Set("Content-Type", "application/json")
-		if err == mongo.ErrNoDocuments {
+		if errors.Is(err, models.ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			json.NewEncoder(w).Encode(map[string]interface{}{
 				"status":  false,
@@ -64,7 +55,111 @@ func (h *RewardsHandler) FetchRewardsByID(w http.ResponseWriter, r *http.Request
 		"status":     true,
 		"message":    "Rewards fetched successfully",
 		"coins":      reward.Coins,
+		"available":  reward.Available(),
+		"held":       reward.Held,
+		"total":      reward.Coins,
 		"fetched_at": time.Now().Format(time.RFC3339),
 	})
 
 }
+
+// ReconcileRewards rebuilds a user's cached balance from the ledger. It is an admin job
+// so that reading a balance never writes.
+func (h *RewardsHandler) ReconcileRewards(w http.ResponseWriter, r *http.Request) {
+	userID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid user ID",
+		})
+		return
+	}
+
+	reward, err := h.rewardsModel.Reconcile(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, models.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to reconcile rewards: " + err.Error(),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    true,
+		"message":   "Rewards reconciled with the ledger",
+		"coins":     reward.Coins,
+		"available": reward.Available(),
+		"held":      reward.Held,
+	})
+}
+
+func (h *RewardsHandler) FetchRewardsHistory(w http.ResponseWriter, r *http.Request) {
+
+	userID := UserIDFromContext(r.Context())
+
+	page, limit, err := parsePage(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+			"entries": []interface{}{},
+		})
+		return
+	}
+
+	entries, total, err := h.rewardsModel.GetHistory(userID, page, limit)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to fetch history: " + err.Error(),
+			"entries": []interface{}{},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "History fetched successfully",
+		"entries": entries,
+		"page":    page,
+		"limit":   limit,
+		"total":   total,
+	})
+}
+
+// parsePage reads the optional page (1-based) and limit query parameters.
+func parsePage(r *http.Request) (int, int, error) {
+	page, limit := 1, 20
+
+	if v := r.URL.Query().Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return 0, 0, errors.New("page must be a positive integer")
+		}
+		page = n
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			return 0, 0, errors.New("limit must be between 1 and 100")
+		}
+		limit = n
+	}
+
+	return page, limit, nil
+}
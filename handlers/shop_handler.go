@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/suraj/nitabuddy/config"
+	"github.com/suraj/nitabuddy/models"
+	"github.com/suraj/nitabuddy/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ShopHandler serves the store catalog: a public list and admin-only changes.
+type ShopHandler struct {
+	shopModel *models.ShopModel
+	campus    config.CampusConfig
+}
+
+func NewShopHandler(shopModel *models.ShopModel, cfg *config.Config) *ShopHandler {
+	return &ShopHandler{
+		shopModel: shopModel,
+		campus:    cfg.Campus,
+	}
+}
+
+// FetchStores lists the catalog by name, optionally filtered with ?category=.
+func (h *ShopHandler) FetchStores(w http.ResponseWriter, r *http.Request) {
+	category := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("category")))
+
+	stores, err := h.shopModel.GetShops(category)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to fetch stores: " + err.Error(),
+			"stores":  []interface{}{},
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     true,
+		"message":    "Stores fetched",
+		"stores":     stores,
+		"categories": h.campus.StoreCategories,
+	})
+}
+
+func (h *ShopHandler) FetchStore(w http.ResponseWriter, r *http.Request) {
+	storeID, ok := storeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	store, err := h.shopModel.GetShop(storeID)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Store fetched",
+		"store":   store,
+	})
+}
+
+func (h *ShopHandler) CreateStore(w http.ResponseWriter, r *http.Request) {
+	input, ok := h.decodeStore(w, r)
+	if !ok {
+		return
+	}
+
+	store := input.Shop()
+	if err := h.shopModel.CreateShop(store); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Store created",
+		"store":   store,
+	})
+}
+
+// UpdateStore replaces a store's details. Orders already placed keep the old name.
+func (h *ShopHandler) UpdateStore(w http.ResponseWriter, r *http.Request) {
+	storeID, ok := storeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+	input, ok := h.decodeStore(w, r)
+	if !ok {
+		return
+	}
+
+	store := input.Shop()
+	if err := h.shopModel.UpdateShop(storeID, store); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Store updated",
+		"store":   store,
+	})
+}
+
+func (h *ShopHandler) DeleteStore(w http.ResponseWriter, r *http.Request) {
+	storeID, ok := storeIDFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.shopModel.DeleteShop(storeID); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Store deleted",
+	})
+}
+
+// decodeStore reads and validates the body of CreateStore and UpdateStore. It writes
+// the error response itself and reports whether the input is usable.
+func (h *ShopHandler) decodeStore(w http.ResponseWriter, r *http.Request) (*validation.Store, bool) {
+	var input validation.Store
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return nil, false
+	}
+
+	input.Normalize()
+	if fieldErrors := input.Validate(h.campus); fieldErrors != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Please correct the highlighted fields",
+			"errors":  fieldErrors,
+		})
+		return nil, false
+	}
+
+	return &input, true
+}
+
+func storeIDFromPath(w http.ResponseWriter, r *http.Request) (primitive.ObjectID, bool) {
+	storeID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Invalid store ID",
+		})
+		return primitive.NilObjectID, false
+	}
+	return storeID, true
+}
+
+func writeStoreError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var duplicate *models.DuplicateError
+	if errors.As(err, &duplicate) {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "A store with this " + duplicate.Field + " already exists",
+			"errors":  validation.FieldErrors{duplicate.Field: duplicate.Field + " is already taken"},
+		})
+		return
+	}
+
+	if errors.Is(err, models.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+	} else {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  false,
+		"message": err.Error(),
+	})
+}
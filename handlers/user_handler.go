@@ -2,26 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/suraj/nitabuddy/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func (h *AuthHandler) GetUserProfile(w http.ResponseWriter, r *http.Request) {
 
 	// Get userId from token
-	userID, err := h.GetUserIDFromToken(r)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusUnauthorized)
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  false,
-			"message": "Invalid or missing token",
-			"user":    nil,
-		})
-		return
-	}
+	userID := UserIDFromContext(r.Context())
 
 	// Get user details from token
 	user, err := h.userModel.GetUserByID(userID)
@@ -44,8 +36,12 @@ func (h *AuthHandler) GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GetUserProfileFromID returns another user's public profile. Contact details are only
+// included while the caller and that user share an active order.
 func (h *AuthHandler) GetUserProfileFromID(w http.ResponseWriter, r *http.Request) {
 
+	viewerID := UserIDFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	userIDstr := vars["id"]
 	userID, err := primitive.ObjectIDFromHex(userIDstr)
@@ -61,13 +57,23 @@ func (h *AuthHandler) GetUserProfileFromID(w http.ResponseWriter, r *http.Reques
 	}
 
 	// Get user details from id
-	user, err := h.userModel.GetUserByID(userID)
+	profile, err := h.userModel.GetPublicProfile(viewerID, userID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusNotFound)
+		if errors.Is(err, models.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status":  false,
+				"message": "user not found",
+				"user":    nil,
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"status":  false,
-			"message": "user not found",
+			"message": "Failed to fetch user: " + err.Error(),
 			"user":    nil,
 		})
 		return
@@ -77,6 +83,6 @@ func (h *AuthHandler) GetUserProfileFromID(w http.ResponseWriter, r *http.Reques
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":  true,
 		"message": "user details fetched successfully",
-		"user":    user,
+		"user":    profile,
 	})
 }
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/suraj/nitabuddy/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Verification tokens are signed with the JWT secret but carry their own audience,
+// so they can never be used as access tokens or the other way round.
+func (h *AuthHandler) verificationAudience() string {
+	return h.jwt.Audience + "/verify-email"
+}
+
+// VerifyEmail marks the address in a verification token as verified and grants the signup bonus.
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "token is required",
+		})
+		return
+	}
+
+	userID, email, err := h.parseVerificationToken(input.Token)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	verified, err := h.userModel.VerifyEmail(userID, email)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to verify email: " + err.Error(),
+		})
+		return
+	}
+
+	message := "Email verified. Your signup coins have been added."
+	if !verified {
+		message = "Email already verified"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": message,
+	})
+}
+
+// ResendVerification mails a fresh verification token to the caller.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID := UserIDFromContext(r.Context())
+
+	user, err := h.userModel.GetUserByID(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "user not found",
+		})
+		return
+	}
+
+	if user.EmailVerified {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  true,
+			"message": "Email already verified",
+		})
+		return
+	}
+
+	if err := h.sendVerificationEmail(r.Context(), user); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  false,
+			"message": "Failed to send verification email",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  true,
+		"message": "Verification email sent",
+	})
+}
+
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := h.generateVerificationToken(user)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your email address to start using NITA Buddy and receive your %d signup coins.\n\nVerification token:\n%s\n\nIt expires in %s.",
+		user.Name, models.SignupBonus, token, h.verificationTTL)
+
+	if err := h.mailer.Send(ctx, user.Email, "Verify your NITA Buddy email", body); err != nil {
+		log.Printf("failed to send verification email to %s: %v", user.Email, err)
+		return err
+	}
+
+	return nil
+}
+
+func (h *AuthHandler) generateVerificationToken(user *models.User) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub":   user.ID.Hex(),
+		"email": user.Email,
+		"iat":   now.Unix(),
+		"exp":   now.Add(h.verificationTTL).Unix(),
+		"iss":   h.jwt.Issuer,
+		"aud":   h.verificationAudience(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(h.jwt.Secret)
+}
+
+func (h *AuthHandler) parseVerificationToken(tokenString string) (primitive.ObjectID, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return h.jwt.Secret, nil
+	},
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(h.jwt.Issuer),
+		jwt.WithAudience(h.verificationAudience()),
+	)
+	if err != nil || !token.Valid {
+		return primitive.NilObjectID, "", fmt.Errorf("invalid or expired verification token")
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	sub, _ := claims.GetSubject()
+	email, _ := claims["email"].(string)
+
+	userID, err := primitive.ObjectIDFromHex(sub)
+	if err != nil || email == "" {
+		return primitive.NilObjectID, "", fmt.Errorf("invalid or expired verification token")
+	}
+
+	return userID, email, nil
+}
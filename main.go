@@ -4,12 +4,15 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
+	"github.com/suraj/nitabuddy/config"
 	"github.com/suraj/nitabuddy/database"
 	"github.com/suraj/nitabuddy/handlers"
 	"github.com/suraj/nitabuddy/models"
+	"github.com/suraj/nitabuddy/notify"
 	"github.com/suraj/nitabuddy/routes"
 )
 
@@ -19,28 +22,117 @@ func main() {
 		log.Println("No .env file found (likely running in production):", err)
 	}
 
-	// Connect to MongoDB
-	client, userCollection, orderCollection, rewardsCollection := database.Connect() // returns collection reference
-	defer client.Disconnect(context.Background())
+	cfg := config.Load()
+
+	// "migrate" brings the database up to date and exits without serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(cfg)
+		return
+	}
+
+	// Pick the storage backend: MongoDB by default, STORAGE_BACKEND=memory for a database-free local run
+	var userStore models.UserStore
+	var orderStore models.OrderStore
+	var rewardsStore models.RewardsStore
+	var ledgerStore models.LedgerStore
+	var refreshTokenStore models.RefreshTokenStore
+	var revocationStore models.RevocationStore
+	var passwordResetStore models.PasswordResetStore
+	var shopStore models.ShopStore
+	var txRunner models.TxRunner
+
+	switch cfg.StorageBackend {
+	case "mongo":
+		// Connect to MongoDB
+		client, db := database.Connect()
+		defer client.Disconnect(context.Background())
+		if cfg.MigrateOnStartup {
+			if err := database.Migrate(db); err != nil {
+				log.Fatal(err)
+			}
+		}
+		database.EnsureIndexes(db)
+
+		userStore = models.NewMongoUserStore(db.Collection("users"))
+		orderStore = models.NewMongoOrderStore(db.Collection("orders"))
+		rewardsStore = models.NewMongoRewardsStore(db.Collection("rewards"), db.Collection("coin_holds"))
+		ledgerStore = models.NewMongoLedgerStore(db.Collection("ledger"))
+		refreshTokenStore = models.NewMongoRefreshTokenStore(db.Collection("refresh_tokens"))
+		revocationStore = models.NewMongoRevocationStore(db.Collection("revoked_tokens"))
+		passwordResetStore = models.NewMongoPasswordResetStore(db.Collection("password_resets"))
+		shopStore = models.NewMongoShopStore(db.Collection("stores"))
+		mongoTx, err := models.NewMongoTxRunner(client, cfg.AllowNonTransactional)
+		if err != nil {
+			log.Fatal(err)
+		}
+		txRunner = mongoTx
+	case "memory":
+		log.Println("Using in-memory storage: data is lost when the server stops")
+		memDB := models.NewMemoryDB()
+		userStore = models.NewMemoryUserStore(memDB)
+		orderStore = models.NewMemoryOrderStore(memDB)
+		rewardsStore = models.NewMemoryRewardsStore(memDB)
+		ledgerStore = models.NewMemoryLedgerStore(memDB)
+		refreshTokenStore = models.NewMemoryRefreshTokenStore(memDB)
+		revocationStore = models.NewMemoryRevocationStore(memDB)
+		passwordResetStore = models.NewMemoryPasswordResetStore(memDB)
+		shopStore = models.NewMemoryShopStore(memDB)
+		txRunner = memDB
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q (expected \"mongo\" or \"memory\")", cfg.StorageBackend)
+	}
 
 	// Create Models
-	rewardsModel := models.NewRewardsModel(rewardsCollection)
-	userModel := models.NewUserModel(userCollection, rewardsModel)
-	orderModel := models.NewOrderModel(orderCollection, userCollection, rewardsModel)
+	rewardsModel := models.NewRewardsModel(rewardsStore, ledgerStore, txRunner)
+	userModel := models.NewUserModel(userStore, orderStore, rewardsModel, refreshTokenStore, txRunner)
+	shopModel := models.NewShopModel(shopStore, cfg.Campus.Timezone)
+	orderModel := models.NewOrderModel(orderStore, userStore, rewardsModel, shopModel, txRunner, models.OrderExpiry{
+		Default:  cfg.Orders.DefaultTTL,
+		Max:      cfg.Orders.MaxTTL,
+		PerStore: cfg.Orders.StoreTTLs,
+	}, models.ReleasePolicy{
+		Free:    cfg.Orders.FreeReleases,
+		Window:  cfg.Orders.ReleaseWindow,
+		Penalty: cfg.Orders.ReleasePenalty,
+	}, models.NewHostelMap(cfg.Campus.HostelDistances))
+	tokenModel := models.NewTokenModel(refreshTokenStore, revocationStore, cfg.JWT.RefreshTTL)
+	resetModel := models.NewPasswordResetModel(passwordResetStore, userStore, refreshTokenStore, txRunner, cfg.PasswordResetTTL)
 
-	// Define your JWT secret key (keep it safe and strong)
-	jwtSecret := []byte("my-secret-key")
+	mailer, err := notify.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Create handlers with JWT-based auth
-	authHandler := handlers.NewAuthHandler(userModel, jwtSecret)
-	orderHandler := handlers.NewOrderHandler(orderModel, authHandler)       // Pass authHandler
-	rewardsHandler := handlers.NewRewardsHandler(rewardsModel, authHandler) // Pass authHandler
+	authHandler := handlers.NewAuthHandler(userModel, tokenModel, resetModel, mailer, cfg)
+	orderHandler := handlers.NewOrderHandler(orderModel, userModel, mailer)
+	rewardsHandler := handlers.NewRewardsHandler(rewardsModel)
+	shopHandler := handlers.NewShopHandler(shopModel, cfg)
+
+	// Close orders nobody accepted in time and refund their placers
+	go orderModel.RunExpirySweeper(context.Background(), cfg.Orders.SweepInterval)
 
 	// configure router
 	r := mux.NewRouter()
-	routes.Setup(r, authHandler, orderHandler, rewardsHandler)
+	routes.Setup(r, authHandler, orderHandler, rewardsHandler, shopHandler)
 
 	// Start server
 	log.Println("Server starting at port 8080...")
 	log.Fatal(http.ListenAndServe(":8080", r))
 }
+
+func migrate(cfg *config.Config) {
+	if cfg.StorageBackend != "mongo" {
+		log.Fatalf("Nothing to migrate for STORAGE_BACKEND=%s", cfg.StorageBackend)
+	}
+
+	client, db := database.Connect()
+	defer client.Disconnect(context.Background())
+
+	if err := database.Migrate(db); err != nil {
+		log.Fatal(err)
+	}
+	database.EnsureIndexes(db)
+
+	log.Println("Database is up to date")
+}
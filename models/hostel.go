@@ -0,0 +1,62 @@
+package models
+
+import "math"
+
+// unknownDistance ranks hostels with no known route, and orders with no hostel, last.
+const unknownDistance = math.MaxInt32
+
+// HostelMap knows how far apart the campus hostels are. It is built from the distances
+// between neighbouring hostels; any other pair is as far apart as the shortest route.
+type HostelMap struct {
+	distances map[string]map[string]int
+}
+
+// NewHostelMap builds the map from neighbour distances, which apply both ways. A pair
+// given in both directions with different distances keeps the shorter one.
+func NewHostelMap(neighbours map[string]map[string]int) *HostelMap {
+	distances := make(map[string]map[string]int)
+	set := func(a, b string, d int) {
+		if distances[a] == nil {
+			distances[a] = map[string]int{a: 0}
+		}
+		if current, ok := distances[a][b]; !ok || d < current {
+			distances[a][b] = d
+		}
+	}
+
+	for a, row := range neighbours {
+		for b, d := range row {
+			set(a, b, d)
+			set(b, a, d)
+		}
+	}
+
+	// Floyd-Warshall; there are only a handful of hostels
+	for k := range distances {
+		for i := range distances {
+			ik, ok := distances[i][k]
+			if !ok {
+				continue
+			}
+			for j, kj := range distances[k] {
+				set(i, j, ik+kj)
+			}
+		}
+	}
+
+	return &HostelMap{distances: distances}
+}
+
+// DistancesFrom returns the distance from hostel to every hostel reachable from it,
+// including hostel itself. An empty hostel has no distances.
+func (m *HostelMap) DistancesFrom(hostel string) map[string]int {
+	if hostel == "" {
+		return map[string]int{}
+	}
+
+	distances := map[string]int{hostel: 0}
+	for other, d := range m.distances[hostel] {
+		distances[other] = d
+	}
+	return distances
+}
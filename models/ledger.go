@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TreasuryAccount is the system side of every coin that enters or leaves circulation,
+// e.g. signup bonuses. Its balance is the negative of all coins ever issued.
+var TreasuryAccount = primitive.NilObjectID
+
+// Ledger buckets. A user's total balance is available + held.
+const (
+	BucketAvailable = "available"
+	BucketHeld      = "held"
+)
+
+// Ledger reasons
+const (
+	ReasonOpeningBalance = "opening_balance"
+	ReasonSignupBonus    = "signup_bonus"
+	ReasonOrderHold      = "order_hold"
+	ReasonOrderRefund    = "order_refund"
+	ReasonOrderFee       = "order_fee"
+	ReasonRunnerPayout   = "runner_payout"
+	ReasonReleasePenalty = "release_penalty"
+	ReasonDisputeRefund  = "dispute_refund"
+)
+
+// LedgerEntry is one leg of a coin movement. The entries sharing a TxnID always sum to zero.
+// Entries are only ever appended, never updated or deleted.
+type LedgerEntry struct {
+	ID        primitive.ObjectID  `bson:"_id" json:"id"`
+	TxnID     primitive.ObjectID  `bson:"txn_id" json:"txn_id"`
+	Account   primitive.ObjectID  `bson:"account" json:"-"`
+	Bucket    string              `bson:"bucket" json:"bucket"`
+	Amount    int                 `bson:"amount" json:"amount"`
+	Reason    string              `bson:"reason" json:"reason"`
+	OrderID   *primitive.ObjectID `bson:"order_id,omitempty" json:"order_id,omitempty"`
+	CreatedAt time.Time           `bson:"created_at" json:"created_at"`
+}
+
+// LedgerStore persists the append-only coin ledger.
+type LedgerStore interface {
+	Append(ctx context.Context, entries []LedgerEntry) error
+	HasEntries(ctx context.Context, account primitive.ObjectID) (bool, error)
+	// Balances sums an account's entries per bucket.
+	Balances(ctx context.Context, account primitive.ObjectID) (available, held int, err error)
+	// History returns an account's entries newest first, skipping the first skip of them.
+	History(ctx context.Context, account primitive.ObjectID, skip, limit int) ([]LedgerEntry, int64, error)
+}
+
+// leg is one side of a coin movement before it is written to the ledger.
+type leg struct {
+	account primitive.ObjectID
+	bucket  string
+	amount  int
+	reason  string
+}
+
+// record appends one balanced movement to the ledger. It must run before the cached
+// balance in the rewards collection is changed, so that accounts created before the
+// ledger existed get an opening balance that matches what they held until now.
+func (r *RewardsModel) record(ctx context.Context, orderID primitive.ObjectID, legs ...leg) error {
+	for _, l := range legs {
+		if err := r.openAccount(ctx, l.account); err != nil {
+			return err
+		}
+	}
+
+	return r.appendLegs(ctx, orderID, legs)
+}
+
+// openAccount writes an opening balance for a user whose coins predate the ledger.
+func (r *RewardsModel) openAccount(ctx context.Context, account primitive.ObjectID) error {
+	if account == TreasuryAccount {
+		return nil
+	}
+
+	opened, err := r.ledger.HasEntries(ctx, account)
+	if err != nil || opened {
+		return err
+	}
+
+	reward, err := r.store.FindByUserID(ctx, account)
+	if errors.Is(err, ErrNotFound) {
+		return nil // brand new user: the signup bonus opens the account
+	}
+	if err != nil {
+		return err
+	}
+	if reward.Coins == 0 && reward.Held == 0 {
+		return nil
+	}
+
+	return r.appendLegs(ctx, primitive.NilObjectID, []leg{
+		{TreasuryAccount, BucketAvailable, -reward.Coins, ReasonOpeningBalance},
+		{account, BucketAvailable, reward.Available(), ReasonOpeningBalance},
+		{account, BucketHeld, reward.Held, ReasonOpeningBalance},
+	})
+}
+
+func (r *RewardsModel) appendLegs(ctx context.Context, orderID primitive.ObjectID, legs []leg) error {
+	sum := 0
+	for _, l := range legs {
+		sum += l.amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("unbalanced ledger movement: legs sum to %d", sum)
+	}
+
+	var orderRef *primitive.ObjectID
+	if !orderID.IsZero() {
+		orderRef = &orderID
+	}
+
+	txnID := primitive.NewObjectID()
+	now := time.Now()
+	entries := make([]LedgerEntry, 0, len(legs))
+	for _, l := range legs {
+		if l.amount == 0 {
+			continue
+		}
+		entries = append(entries, LedgerEntry{
+			ID:        primitive.NewObjectID(),
+			TxnID:     txnID,
+			Account:   l.account,
+			Bucket:    l.bucket,
+			Amount:    l.amount,
+			Reason:    l.reason,
+			OrderID:   orderRef,
+			CreatedAt: now,
+		})
+	}
+
+	return r.ledger.Append(ctx, entries)
+}
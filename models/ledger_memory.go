@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryLedgerStore is the in-memory implementation of LedgerStore.
+type MemoryLedgerStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryLedgerStore(db *MemoryDB) *MemoryLedgerStore {
+	return &MemoryLedgerStore{db: db}
+}
+
+func (s *MemoryLedgerStore) Append(ctx context.Context, entries []LedgerEntry) error {
+	defer s.db.lock(ctx)()
+
+	// Build a new slice so a rolled-back transaction's snapshot is never written through
+	ledger := make([]LedgerEntry, 0, len(s.db.ledger)+len(entries))
+	s.db.ledger = append(append(ledger, s.db.ledger...), entries...)
+	return nil
+}
+
+func (s *MemoryLedgerStore) HasEntries(ctx context.Context, account primitive.ObjectID) (bool, error) {
+	defer s.db.rlock(ctx)()
+
+	for _, entry := range s.db.ledger {
+		if entry.Account == account {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryLedgerStore) Balances(ctx context.Context, account primitive.ObjectID) (int, int, error) {
+	defer s.db.rlock(ctx)()
+
+	var available, held int
+	for _, entry := range s.db.ledger {
+		if entry.Account != account {
+			continue
+		}
+		switch entry.Bucket {
+		case BucketAvailable:
+			available += entry.Amount
+		case BucketHeld:
+			held += entry.Amount
+		}
+	}
+	return available, held, nil
+}
+
+func (s *MemoryLedgerStore) History(ctx context.Context, account primitive.ObjectID, skip, limit int) ([]LedgerEntry, int64, error) {
+	defer s.db.rlock(ctx)()
+
+	// Walk backwards so entries written together keep Mongo's _id-descending tie order
+	var entries []LedgerEntry
+	for i := len(s.db.ledger) - 1; i >= 0; i-- {
+		if s.db.ledger[i].Account == account {
+			entries = append(entries, s.db.ledger[i])
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+
+	total := int64(len(entries))
+	if skip >= len(entries) {
+		return nil, total, nil
+	}
+	entries = entries[skip:]
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, total, nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoLedgerStore is the MongoDB implementation of LedgerStore.
+type MongoLedgerStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoLedgerStore(collection *mongo.Collection) *MongoLedgerStore {
+	return &MongoLedgerStore{collection: collection}
+}
+
+func (s *MongoLedgerStore) Append(ctx context.Context, entries []LedgerEntry) error {
+	docs := make([]interface{}, len(entries))
+	for i := range entries {
+		docs[i] = entries[i]
+	}
+
+	_, err := s.collection.InsertMany(ctx, docs)
+	return err
+}
+
+func (s *MongoLedgerStore) HasEntries(ctx context.Context, account primitive.ObjectID) (bool, error) {
+	err := s.collection.FindOne(ctx, bson.M{"account": account}).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *MongoLedgerStore) Balances(ctx context.Context, account primitive.ObjectID) (int, int, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"account": account}}},
+		{{Key: "$group", Value: bson.M{"_id": "$bucket", "total": bson.M{"$sum": "$amount"}}}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var available, held int
+	for cursor.Next(ctx) {
+		var row struct {
+			Bucket string `bson:"_id"`
+			Total  int    `bson:"total"`
+		}
+		if err := cursor.Decode(&row); err != nil {
+			return 0, 0, err
+		}
+		switch row.Bucket {
+		case BucketAvailable:
+			available = row.Total
+		case BucketHeld:
+			held = row.Total
+		}
+	}
+
+	return available, held, cursor.Err()
+}
+
+func (s *MongoLedgerStore) History(ctx context.Context, account primitive.ObjectID, skip, limit int) ([]LedgerEntry, int64, error) {
+	filter := bson.M{"account": account}
+
+	total, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var entries []LedgerEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
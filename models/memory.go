@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryDB holds the data behind every in-memory store. It lets the whole API run
+// without MongoDB, e.g. on a laptop or in handler tests.
+type MemoryDB struct {
+	mu sync.RWMutex
+	memoryData
+}
+
+// memoryData is one map (or slice) per Mongo collection.
+type memoryData struct {
+	users   map[primitive.ObjectID]User
+	orders  map[primitive.ObjectID]Order
+	rewards map[primitive.ObjectID]Rewards
+	holds   map[primitive.ObjectID]CoinHold // keyed by order ID
+	ledger  []LedgerEntry                   // append-only, oldest first
+
+	refreshTokens map[primitive.ObjectID]RefreshToken
+	revokedTokens map[string]RevokedToken // keyed by jti
+
+	passwordResets map[primitive.ObjectID]PasswordReset
+
+	shops map[primitive.ObjectID]Shop
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{memoryData: memoryData{
+		users:   make(map[primitive.ObjectID]User),
+		orders:  make(map[primitive.ObjectID]Order),
+		rewards: make(map[primitive.ObjectID]Rewards),
+		holds:   make(map[primitive.ObjectID]CoinHold),
+
+		refreshTokens: make(map[primitive.ObjectID]RefreshToken),
+		revokedTokens: make(map[string]RevokedToken),
+
+		passwordResets: make(map[primitive.ObjectID]PasswordReset),
+
+		shops: make(map[primitive.ObjectID]Shop),
+	}}
+}
+
+// memoryTxKey marks a context that already holds the MemoryDB write lock.
+type memoryTxKey struct{}
+
+// WithTransaction holds the write lock for the whole of fn and restores the
+// previous data if fn fails, which gives the same guarantee as a Mongo transaction.
+func (db *MemoryDB) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if db.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := db.snapshot()
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, db)); err != nil {
+		db.memoryData = saved
+		return err
+	}
+	return nil
+}
+
+// snapshot copies every collection. Stores replace values wholesale and only ever
+// grow the ledger into a new slice, so shallow copies are enough.
+func (db *MemoryDB) snapshot() memoryData {
+	saved := db.memoryData
+	saved.users = maps.Clone(db.users)
+	saved.orders = maps.Clone(db.orders)
+	saved.rewards = maps.Clone(db.rewards)
+	saved.holds = maps.Clone(db.holds)
+	saved.refreshTokens = maps.Clone(db.refreshTokens)
+	saved.revokedTokens = maps.Clone(db.revokedTokens)
+	saved.passwordResets = maps.Clone(db.passwordResets)
+	saved.shops = maps.Clone(db.shops)
+	return saved
+}
+
+func (db *MemoryDB) inTx(ctx context.Context) bool {
+	return ctx.Value(memoryTxKey{}) == db
+}
+
+// lock takes the write lock and returns the matching unlock func.
+// Inside a transaction the lock is already held, so it does nothing.
+func (db *MemoryDB) lock(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
+	}
+	db.mu.Lock()
+	return db.mu.Unlock
+}
+
+// rlock takes the read lock and returns the matching unlock func.
+func (db *MemoryDB) rlock(ctx context.Context) func() {
+	if db.inTx(ctx) {
+		return func() {}
+	}
+	db.mu.RLock()
+	return db.mu.RUnlock
+}
@@ -2,286 +2,689 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math/rand"
+	"slices"
+	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type Order struct {
-	OrderID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	CustomOrderID string             `bson:"custom_order_id" json:"custom_order_id"`
-	Store         string             `bson:"store" json:"store"`
-	OrderDetails  string             `bson:"order_details" json:"order_details"`
-	Status        string             `bson:"status" json:"status"`
-	OTP           string             `bson:"otp" json:"otp"`
-	Phone         string             `bson:"phone" json:"phone"`
-	PlacedBy      primitive.ObjectID `bson:"placed_by" json:"placed_by"`
-	PlacedByName  string             `bson:"placed_by_name" json:"placed_by_name"`
-	AcceptedBy    primitive.ObjectID `bson:"accepted_by" json:"accepted_by"`
-	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	OrderID       primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	CustomOrderID string              `bson:"custom_order_id" json:"custom_order_id"`
+	StoreID       *primitive.ObjectID `bson:"store_id,omitempty" json:"store_id,omitempty"` // nil for free-text stores
+	Store         string              `bson:"store" json:"store"`                           // the name when the order was placed
+	OrderDetails  string              `bson:"order_details" json:"order_details"`
+	Status        string              `bson:"status" json:"status"`
+	OTP           string              `bson:"otp" json:"otp,omitempty"`     // see ViewFor
+	Phone         string              `bson:"phone" json:"phone,omitempty"` // see ViewFor
+	PlacedBy      primitive.ObjectID  `bson:"placed_by" json:"placed_by"`
+	PlacedByName  string              `bson:"placed_by_name" json:"placed_by_name"`
+	Hostel        string              `bson:"hostel" json:"hostel"` // the placer's, when the order was placed
+	AcceptedBy    primitive.ObjectID  `bson:"accepted_by" json:"accepted_by"`
+	CreatedAt     time.Time           `bson:"created_at" json:"created_at"`
+	ExpiresAt     time.Time           `bson:"expires_at" json:"expires_at"` // when an unaccepted order leaves the feed
+	TTL           time.Duration       `bson:"ttl,omitempty" json:"-"`       // how long it waits for a runner, each time it is open
+	History       []StatusChange      `bson:"history" json:"-"`             // oldest first, see GetOrderHistory
+
+	// Optional itemised version of OrderDetails. Amounts are in paise.
+	Items          []OrderItem `bson:"items,omitempty" json:"items,omitempty"`
+	EstimatedTotal int64       `bson:"estimated_total,omitempty" json:"estimated_total_paise,omitempty"`
+	MaxSpend       int64       `bson:"max_spend,omitempty" json:"max_spend_paise,omitempty"` // the most the placer will pay; 0 means no limit
+
+	// Set when the runner completes the order with the bill, see CompleteOrder
+	Settlement *Settlement `bson:"settlement,omitempty" json:"settlement,omitempty"`
+
+	// Set once the parties rate each other, see RateOrder
+	RunnerRating *Rating `bson:"runner_rating,omitempty" json:"runner_rating,omitempty"` // the placer's rating of the runner
+	PlacerRating *Rating `bson:"placer_rating,omitempty" json:"placer_rating,omitempty"` // the runner's rating of the placer
+
+	// Set once the order is cancelled
+	CancelledAt  *time.Time `bson:"cancelled_at,omitempty" json:"cancelled_at,omitempty"`
+	CancelReason string     `bson:"cancel_reason,omitempty" json:"cancel_reason,omitempty"`
+	// CancelRequest is the placer's wish to cancel after a runner accepted, awaiting the runner's agreement
+	CancelRequest *CancelRequest `bson:"cancel_request,omitempty" json:"cancel_request,omitempty"`
+}
+
+// OrderItem is one line of an itemised order. Prices are the placer's estimate, in paise.
+type OrderItem struct {
+	Name               string `bson:"name" json:"name"`
+	Quantity           int    `bson:"quantity" json:"quantity"`
+	EstimatedUnitPrice int64  `bson:"estimated_unit_price" json:"estimated_unit_price_paise"`
+	Notes              string `bson:"notes,omitempty" json:"notes,omitempty"`
+}
+
+// EstimatedTotal is what the items should cost at the estimated prices.
+func EstimatedTotal(items []OrderItem) int64 {
+	var total int64
+	for _, item := range items {
+		total += int64(item.Quantity) * item.EstimatedUnitPrice
+	}
+	return total
+}
+
+// Settlement is what the runner actually paid at the store, against the placer's
+// estimate, and how the placer paid it back. Amounts are in paise.
+type Settlement struct {
+	Estimated   int64      `bson:"estimated" json:"estimated_paise"`
+	Actual      int64      `bson:"actual" json:"actual_paise"`
+	ReceiptRef  string     `bson:"receipt_ref,omitempty" json:"receipt_ref,omitempty"` // e.g. the URL of a photo of the bill
+	SubmittedAt time.Time  `bson:"submitted_at" json:"submitted_at"`
+	PaidVia     string     `bson:"paid_via,omitempty" json:"paid_via,omitempty"` // set when the placer confirms
+	ConfirmedAt *time.Time `bson:"confirmed_at,omitempty" json:"confirmed_at,omitempty"`
+}
+
+// Bill is what the runner submits on completion.
+type Bill struct {
+	Amount     int64 // paise
+	ReceiptRef string
+}
+
+// Ways the placer can pay the runner back.
+const (
+	PaidViaCash = "cash"
+	PaidViaUPI  = "upi"
+)
+
+type CancelRequest struct {
+	Reason string    `bson:"reason" json:"reason"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+var (
+	ErrOrderNotFound     = fmt.Errorf("order %w", ErrNotFound)
+	ErrOrderAlreadyTaken = errors.New("order already accepted")
+	ErrOwnOrder          = errors.New("can't accept own order")
+	ErrOrderNotAccepted  = errors.New("order is not in accepted state")
+	ErrOrderCompleted    = errors.New("order already completed")
+	ErrOrderExpired      = errors.New("order has expired")
+	ErrOrderClosed       = errors.New("order is no longer open")
+	ErrNotRunner         = errors.New("only the runner who accepted the order can do this")
+	ErrNotOrderParty     = errors.New("you are not part of this order")
+	ErrNotPlacer         = errors.New("only the user who placed the order can do this")
+	ErrNoCancelRequest   = errors.New("the placer has not asked to cancel this order")
+	ErrReleaseLimit      = errors.New("you have released too many orders recently, try again later")
+	ErrReleasePenalty    = errors.New("not enough coins to pay the release penalty")
+	ErrNoSettlement      = errors.New("the runner did not submit a bill for this order")
+	ErrSettlementDone    = errors.New("the bill has already been confirmed")
+	ErrOrderNotCompleted = errors.New("order is not completed")
+	ErrOrderNotDisputed  = errors.New("order is not disputed")
+	ErrBillRequired      = errors.New("the bill amount is required for an itemised order or one with a max spend")
+	ErrOverMaxSpend      = errors.New("the bill is more than the placer's max spend")
+)
+
+// OrderStore persists orders. Implementations return ErrNotFound when no order matches.
+type OrderStore interface {
+	// Insert returns a DuplicateError if the custom order ID is taken.
+	Insert(ctx context.Context, order *Order) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*Order, error)
+	// The list methods below return the orders matching q, sorted and paged as q says.
+
+	// FindOpen returns the orders other users can still accept: not accepted and not expired at now.
+	FindOpen(ctx context.Context, excludeUserID primitive.ObjectID, now time.Time, q OrderQuery) ([]Order, error)
+	// FindByPlacer returns the user's orders in any of statuses.
+	FindByPlacer(ctx context.Context, userID primitive.ObjectID, statuses []string, q OrderQuery) ([]Order, error)
+	// FindAcceptedBy returns the orders the user accepted that are in any of statuses.
+	FindAcceptedBy(ctx context.Context, userID primitive.ObjectID, statuses []string, q OrderQuery) ([]Order, error)
+	// The status writes below are each one conditional write that also appends change to
+	// the order's history. change.By is the acting user and change.At the current time.
+
+	// Accept moves a NotAccepted, unexpired order to Accepted for change.By.
+	// It returns ErrOrderAlreadyTaken if another runner holds the order, ErrOrderClosed if it
+	// is completed, cancelled or disputed, ErrOrderExpired if it has expired and ErrOwnOrder
+	// if change.By placed it.
+	Accept(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error
+	// Complete moves an order in change.From that change.By accepted to Completed, recording
+	// settlement if it is not nil. It returns ErrOrderCompleted if the order is already
+	// completed and ErrOrderNotAccepted otherwise.
+	Complete(ctx context.Context, orderID primitive.ObjectID, change StatusChange, settlement *Settlement) error
+	// ConfirmSettlement records that the placer paid the bill of a Completed order. It
+	// returns ErrSettlementDone if the order has no unconfirmed settlement any more.
+	ConfirmSettlement(ctx context.Context, orderID primitive.ObjectID, paidVia string, at time.Time) error
+	// FindExpired returns the NotAccepted orders whose ExpiresAt is not after now.
+	FindExpired(ctx context.Context, now time.Time) ([]Order, error)
+	// Expire moves a NotAccepted order whose ExpiresAt is not after change.At to Expired.
+	// It returns false if the order no longer qualifies, e.g. because it was just accepted.
+	Expire(ctx context.Context, orderID primitive.ObjectID, change StatusChange) (bool, error)
+	// ChangeStatus moves an order from change.From to change.To. It returns
+	// ErrOrderStatusChanged if the order is no longer in change.From.
+	ChangeStatus(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error
+	// Release hands an Accepted order that change.By accepted back to the feed until
+	// expiresAt, clearing the runner and any cancel request. It returns
+	// ErrOrderStatusChanged if the order is no longer Accepted by change.By.
+	Release(ctx context.Context, orderID primitive.ObjectID, change StatusChange, expiresAt time.Time) error
+	// CountReleasesBy counts the orders runnerID has released since the given time.
+	CountReleasesBy(ctx context.Context, runnerID primitive.ObjectID, since time.Time) (int64, error)
+	// RequestCancel records the placer's request to cancel an Accepted order.
+	// It returns ErrOrderStatusChanged if the order is no longer Accepted.
+	RequestCancel(ctx context.Context, orderID primitive.ObjectID, request CancelRequest) error
+	// Cancel moves an order from change.From to Cancelled, recording change.At and change.Reason
+	// as the cancellation and clearing any cancel request. It returns ErrOrderStatusChanged
+	// if the order is no longer in change.From.
+	Cancel(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error
+	CountCompletedBy(ctx context.Context, runnerID primitive.ObjectID) (int64, error)
+	// SharesActiveOrder reports whether one user is the placer and the other the runner of an order in progress.
+	SharesActiveOrder(ctx context.Context, a, b primitive.ObjectID) (bool, error)
+	// Rate records the rating that rater, who has role (RolePlacer or RoleRunner) on a
+	// Completed order, gives the other party. It returns ErrAlreadyRated if that rating
+	// is already set.
+	Rate(ctx context.Context, orderID primitive.ObjectID, role string, rater primitive.ObjectID, rating Rating) error
+	// RatingsOf summarises the ratings userID has received as a runner and as a placer.
+	RatingsOf(ctx context.Context, userID primitive.ObjectID) (Ratings, error)
+}
+
+// OrderExpiry decides how long an order waits to be accepted.
+type OrderExpiry struct {
+	Default  time.Duration
+	Max      time.Duration            // longest a placer may choose
+	PerStore map[string]time.Duration // overrides Default, keyed by lower-cased store name
+}
+
+// ttlFor returns how long an order for store stays open. requested is the placer's
+// choice and zero means no choice.
+func (e OrderExpiry) ttlFor(store string, requested time.Duration) (time.Duration, error) {
+	if requested != 0 {
+		if requested < time.Minute || requested > e.Max {
+			return 0, fmt.Errorf("expiry must be between 1 minute and %s", e.Max)
+		}
+		return requested, nil
+	}
+
+	if ttl, ok := e.PerStore[strings.ToLower(strings.TrimSpace(store))]; ok {
+		return ttl, nil
+	}
+	return e.Default, nil
+}
+
+// ReleasePolicy keeps runners from hoarding orders they then hand back. Each runner may
+// release Free orders per Window; every further release costs Penalty coins, paid to the
+// placer, or is refused if Penalty is zero.
+type ReleasePolicy struct {
+	Free    int
+	Window  time.Duration
+	Penalty int
 }
 
 type OrderModel struct {
-	collection     *mongo.Collection
-	userCollection *mongo.Collection
-	rewardsModel   *RewardsModel // Add this field
+	store        OrderStore
+	userStore    UserStore
+	rewardsModel *RewardsModel // Add this field
+	shopModel    *ShopModel
+	tx           TxRunner
+	expiry       OrderExpiry
+	release      ReleasePolicy
+	hostels      *HostelMap
 }
 
-func NewOrderModel(orderCollection, userCollection *mongo.Collection, rewardsModel *RewardsModel) *OrderModel {
+func NewOrderModel(store OrderStore, userStore UserStore, rewardsModel *RewardsModel, shopModel *ShopModel, tx TxRunner, expiry OrderExpiry, release ReleasePolicy, hostels *HostelMap) *OrderModel {
 	return &OrderModel{
-		collection:     orderCollection,
-		userCollection: userCollection,
-		rewardsModel:   rewardsModel,
+		store:        store,
+		userStore:    userStore,
+		rewardsModel: rewardsModel,
+		shopModel:    shopModel,
+		tx:           tx,
+		expiry:       expiry,
+		release:      release,
+		hostels:      hostels,
 	}
 }
 
-func (m *OrderModel) CreateOrder(store, orderDetails string, placedBy primitive.ObjectID) (*Order, error) {
+// NewOrder is what a placer asks for.
+type NewOrder struct {
+	StoreID      primitive.ObjectID // a catalog store; if zero, Store is taken as free text
+	Store        string
+	OrderDetails string
+	Items        []OrderItem   // optional, alongside OrderDetails
+	MaxSpend     int64         // paise; 0 means no limit
+	ExpiresIn    time.Duration // zero means the store's default
+}
 
-	reward, err := m.rewardsModel.GetRewardsByUserID(placedBy)
-	if err != nil {
-		return nil, fmt.Errorf("could not retrieve reward info: %v", err)
-	}
+// CreateOrder inserts the order and reserves the placer's fee in one transaction, so the
+// same coins can never back two open orders. Orders for a catalog store are refused while
+// it is closed and keep its current name.
+func (m *OrderModel) CreateOrder(placedBy primitive.ObjectID, in NewOrder) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	if reward.Coins < 10 {
-		return nil, fmt.Errorf("not enough coins to place the order")
+	store := strings.TrimSpace(in.Store)
+	var storeID *primitive.ObjectID
+	if !in.StoreID.IsZero() {
+		shop, err := m.shopModel.GetShop(in.StoreID)
+		if err != nil {
+			return nil, err
+		}
+		if !shop.OpenNow {
+			return nil, fmt.Errorf("%w: %s", ErrShopClosed, shop.Name)
+		}
+		store = shop.Name
+		storeID = &shop.ID
+	}
+	if store == "" {
+		return nil, fmt.Errorf("a store is required")
 	}
 
-	status := "NotAccepted"
-	otp := generateOTP()
-	acceptedBy := primitive.NilObjectID
-	customID, err := generateCustomOrderID(m.collection)
+	ttl, err := m.expiry.ttlFor(store, in.ExpiresIn)
 	if err != nil {
 		return nil, err
 	}
 
-	var userDetails struct {
-		Name  string `bson:"name"`
-		Phone string `bson:"phone"`
-	}
-	err = m.userCollection.FindOne(context.Background(), bson.M{"_id": placedBy}).Decode(&userDetails)
+	status := StatusNotAccepted
+	otp := generateOTP()
+	acceptedBy := primitive.NilObjectID
+
+	user, err := m.userStore.FindByID(ctx, placedBy)
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user: %v", err)
 	}
 
+	now := time.Now()
 	order := &Order{
-		CustomOrderID: customID,
-		Store:         store,
-		OrderDetails:  orderDetails,
-		Status:        status,
-		OTP:           otp,
-		Phone:         userDetails.Phone,
-		PlacedBy:      placedBy,
-		PlacedByName:  userDetails.Name,
-		AcceptedBy:    acceptedBy,
-		CreatedAt:     time.Now(),
-	}
-
-	result, err := m.collection.InsertOne(context.Background(), order)
+		StoreID:        storeID,
+		Store:          store,
+		OrderDetails:   in.OrderDetails,
+		Items:          in.Items,
+		EstimatedTotal: EstimatedTotal(in.Items),
+		MaxSpend:       in.MaxSpend,
+		Status:         status,
+		OTP:            otp,
+		Phone:          user.Phone,
+		PlacedBy:       placedBy,
+		PlacedByName:   user.Name,
+		Hostel:         user.Hostel,
+		AcceptedBy:     acceptedBy,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		TTL:            ttl,
+		History:        []StatusChange{{To: status, By: placedBy, At: now}},
+	}
+
+	// The unique index on custom_order_id decides whether a random ID is free;
+	// on a clash the whole transaction is rolled back and retried with a new one
+	maxAttempts := 5
+	for i := 0; i < maxAttempts; i++ {
+		order.OrderID = primitive.NewObjectID()
+		order.CustomOrderID = generateCustomOrderID()
+
+		err = m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := m.rewardsModel.holdOrderFee(ctx, placedBy, order.OrderID); err != nil {
+				if errors.Is(err, ErrInsufficientCoins) {
+					return err
+				}
+				return fmt.Errorf("could not reserve coins: %v", err)
+			}
+
+			return m.store.Insert(ctx, order)
+		})
+		if !errors.Is(err, ErrDuplicate) {
+			break
+		}
+	}
 	if err != nil {
+		if errors.Is(err, ErrDuplicate) {
+			return nil, fmt.Errorf("failed to generate unique custom order id: %w", err)
+		}
 		return nil, err
 	}
 
-	order.OrderID = result.InsertedID.(primitive.ObjectID)
 	return order, nil
 }
 
-func generateCustomOrderID(collection *mongo.Collection) (string, error) {
+func generateCustomOrderID() string {
+	suffix := rand.Intn(90000) + 10000
+	return fmt.Sprintf("#NBO%d", suffix)
+}
+
+func generateOTP() string {
 	rand.Seed(time.Now().UnixNano())
-	maxAttempts := 5
+	code := rand.Intn(9000) + 1000 // 4-digit otp
+	return fmt.Sprintf("%04d", code)
+}
 
-	for i := 0; i < maxAttempts; i++ {
-		suffix := rand.Intn(90000) + 10000
-		id := fmt.Sprintf("#NBO%d", suffix)
+// GetOtherIncompleteOrders returns one page of the feed: the orders userID could accept.
+// A Nearby query ranks them by how far the placer's hostel is from userID's. The cursor
+// for the next page is nil on the last page.
+func (m *OrderModel) GetOtherIncompleteOrders(userID primitive.ObjectID, q OrderQuery) ([]Order, *OrderCursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-		count, err := collection.CountDocuments(context.Background(), bson.M{"custom_order_id": id})
+	if q.Nearby {
+		user, err := m.userStore.FindByID(ctx, userID)
 		if err != nil {
-			return "", err
-		}
-		if count == 0 {
-			return id, nil // unique id found
+			return []Order{}, nil, fmt.Errorf("failed to find user: %v", err)
 		}
+		q.distances = m.hostels.DistancesFrom(user.Hostel)
 	}
 
-	return "", fmt.Errorf("failed to generate unique custom order id")
-}
+	orders, err := m.store.FindOpen(ctx, userID, time.Now(), q.plusOne())
+	if err != nil {
+		return []Order{}, nil, err
+	}
 
-func generateOTP() string {
-	rand.Seed(time.Now().UnixNano())
-	code := rand.Intn(9000) + 1000 // 4-digit otp
-	return fmt.Sprintf("%04d", code)
+	orders, next := q.page(orders)
+	return orders, next, nil
 }
 
-func (m *OrderModel) GetOtherIncompleteOrders(userID primitive.ObjectID) ([]Order, error) {
-	var orders []Order
+// GetOrdersByUserID returns one page of the orders userID placed. An empty status means
+// every status except Cancelled; cancelled orders are only listed when asked for.
+func (m *OrderModel) GetOrdersByUserID(userID primitive.ObjectID, status string, q OrderQuery) ([]Order, *OrderCursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	filter := bson.M{
-		"placed_by": bson.M{"$ne": userID}, // ne : not equal
-		"status":    "NotAccepted",
+	statuses := []string{status}
+	if status == "" {
+		statuses = slices.DeleteFunc(slices.Clone(orderStatuses), func(s string) bool {
+			return s == StatusCancelled
+		})
+	} else if !IsOrderStatus(status) {
+		return []Order{}, nil, fmt.Errorf("unknown status %q", status)
 	}
 
-	cursor, err := m.collection.Find(context.Background(), filter)
+	orders, err := m.store.FindByPlacer(ctx, userID, statuses, q.plusOne())
 	if err != nil {
-		return []Order{}, err
+		return []Order{}, nil, err
 	}
-	defer cursor.Close(context.Background())
 
-	for cursor.Next(context.Background()) {
-		var order Order
-		if err := cursor.Decode(&order); err != nil {
-			return []Order{}, err
-		}
-		orders = append(orders, order)
+	if orders == nil {
+		return []Order{}, nil, nil
 	}
 
-	return orders, nil
+	orders, next := q.page(orders)
+	return orders, next, nil
 }
 
-func (m *OrderModel) GetOrdersByUserID(userID primitive.ObjectID) ([]Order, error) {
-	var orders []Order // slice of name orders, type Order
+// CancelOrder cancels an order userID placed. Before a runner accepts, the order is
+// cancelled at once and the fee refunded. Afterwards the runner has to agree (see
+// AgreeToCancel), so the placer's request is recorded and false returned, unless the
+// placer accepts the penalty: the order is cancelled and the fee paid to the runner.
+func (m *OrderModel) CancelOrder(userID, orderID primitive.ObjectID, reason string, acceptPenalty bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	cursor, err := m.collection.Find(context.Background(), bson.M{"placed_by": userID})
+	order, err := m.findOrder(ctx, orderID)
 	if err != nil {
-		return []Order{}, err
+		return false, err
+	}
+	if order.PlacedBy != userID {
+		return false, ErrNotPlacer
+	}
+	// Later states are settled through a dispute, not by the placer alone
+	if order.Status != StatusNotAccepted && order.Status != StatusAccepted {
+		return false, fmt.Errorf("%w: an order that is %s can no longer be cancelled", ErrInvalidTransition, order.Status)
 	}
-	defer cursor.Close(context.Background())
 
-	for cursor.Next(context.Background()) {
-		var order Order
-		if err := cursor.Decode(&order); err != nil {
-			return []Order{}, err
-		}
-		orders = append(orders, order)
+	change, err := newStatusChange(order.Status, StatusCancelled, userID, strings.TrimSpace(reason))
+	if err != nil {
+		return false, err
 	}
 
-	if orders == nil {
-		return []Order{}, nil
+	if order.Status == StatusNotAccepted {
+		// Cancel and give the reserved fee back together
+		return true, m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := m.store.Cancel(ctx, orderID, change); err != nil {
+				return err
+			}
+			return m.rewardsModel.releaseHold(ctx, orderID)
+		})
+	}
+
+	if !acceptPenalty {
+		return false, m.store.RequestCancel(ctx, orderID, CancelRequest{Reason: change.Reason, At: change.At})
 	}
 
-	return orders, nil
+	// The runner may already have set out, so the fee compensates them
+	if change.Reason == "" {
+		change.Reason = "cancelled with penalty"
+	} else {
+		change.Reason += " (cancelled with penalty)"
+	}
+	return true, m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := m.store.Cancel(ctx, orderID, change); err != nil {
+			return err
+		}
+		return m.rewardsModel.captureHold(ctx, orderID, order.PlacedBy, order.AcceptedBy)
+	})
 }
 
-func (m *OrderModel) CancelOrder(userID, orderID primitive.ObjectID) error {
+// AgreeToCancel lets the runner accept the placer's cancel request. The placer gets the fee back.
+func (m *OrderModel) AgreeToCancel(userID, orderID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	var order Order
-	err := m.collection.FindOne(context.Background(), bson.M{"_id": orderID}).Decode(&order)
+	order, err := m.findOrder(ctx, orderID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return fmt.Errorf("no order found with this id")
-		}
 		return err
 	}
-
-	if order.PlacedBy != userID {
-		return fmt.Errorf("unauthorized: you cannot cancel someone else's order")
+	if order.AcceptedBy != userID {
+		return ErrNotRunner
 	}
-
-	filter := bson.M{
-		"_id":       orderID,
-		"placed_by": userID,
+	if order.CancelRequest == nil {
+		return ErrNoCancelRequest
 	}
 
-	result, err := m.collection.DeleteOne(context.Background(), filter)
+	change, err := newStatusChange(order.Status, StatusCancelled, userID, order.CancelRequest.Reason)
 	if err != nil {
 		return err
 	}
 
-	if result.DeletedCount == 0 {
-		return fmt.Errorf("no order found with this id")
-	}
-
-	return nil
+	return m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := m.store.Cancel(ctx, orderID, change); err != nil {
+			return err
+		}
+		return m.rewardsModel.releaseHold(ctx, orderID)
+	})
 }
 
+// AcceptOrder hands the order to userID. Concurrent accepts are settled by the store,
+// so exactly one runner wins and the rest get ErrOrderAlreadyTaken.
 func (m *OrderModel) AcceptOrder(userID, orderID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	var order Order
-	err := m.collection.FindOne(context.Background(), bson.M{"_id": orderID}).Decode(&order)
+	change, err := newStatusChange(StatusNotAccepted, StatusAccepted, userID, "")
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return fmt.Errorf("order not found")
-		}
 		return err
 	}
 
-	if order.AcceptedBy != primitive.NilObjectID {
-		return fmt.Errorf("order already accepted")
+	err = m.store.Accept(ctx, orderID, change)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrNotFound):
+		return ErrOrderNotFound
+	case errors.Is(err, ErrOrderAlreadyTaken), errors.Is(err, ErrOrderClosed), errors.Is(err, ErrOwnOrder),
+		errors.Is(err, ErrOrderExpired):
+		return err
+	default:
+		return fmt.Errorf("failed to accept order: %v", err)
 	}
+}
+
+// ReleaseOrder lets the runner who accepted an order hand it back to the feed before
+// picking it up. Releases beyond the free allowance cost the runner the penalty, which
+// goes to the placer for the wait. The order gets its original time to live again,
+// counted from the release, so it does not lapse before other runners see it. It returns
+// the order as it was accepted, so the caller can tell the placer.
+func (m *OrderModel) ReleaseOrder(userID, orderID primitive.ObjectID, reason string) (*Order, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	if order.PlacedBy == userID {
-		return fmt.Errorf("can't accept own order")
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.AcceptedBy != userID || order.Status == StatusNotAccepted {
+		return nil, ErrNotRunner
 	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"accepted_by": userID,
-			"status":      "Accepted",
-		},
+	change, err := newStatusChange(order.Status, StatusNotAccepted, userID, strings.TrimSpace(reason))
+	if err != nil {
+		return nil, err
 	}
 
-	_, err = m.collection.UpdateOne(context.Background(), bson.M{"_id": orderID}, update)
+	released, err := m.store.CountReleasesBy(ctx, userID, change.At.Add(-m.release.Window))
 	if err != nil {
-		return fmt.Errorf("failed to accept order: %v", err)
+		return nil, fmt.Errorf("failed to count releases: %v", err)
+	}
+	penalty := 0
+	if released >= int64(m.release.Free) {
+		if m.release.Penalty <= 0 {
+			return nil, ErrReleaseLimit
+		}
+		penalty = m.release.Penalty
 	}
 
-	return nil
-}
+	// The order gets its full wait again. Orders placed before TTL was stored get their
+	// store's default.
+	ttl := order.TTL
+	if ttl <= 0 {
+		ttl, _ = m.expiry.ttlFor(order.Store, 0)
+	}
+	expiresAt := change.At.Add(ttl)
 
-func (m *OrderModel) GetAcceptedOrders(userID primitive.ObjectID) ([]Order, error) {
-	var orders []Order
+	err = m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := m.store.Release(ctx, orderID, change, expiresAt); err != nil {
+			return err
+		}
+		if penalty == 0 {
+			return nil
+		}
 
-	filter := bson.M{
-		"accepted_by": userID,
-		"status":      "Accepted",
+		err := m.rewardsModel.payReleasePenalty(ctx, orderID, userID, order.PlacedBy, penalty)
+		if errors.Is(err, ErrInsufficientCoins) {
+			return ErrReleasePenalty
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	cursor, err := m.collection.Find(context.Background(), filter)
+	return order, nil
+}
+
+// ExpireStaleOrders moves every open order past its ExpiresAt to Expired and gives the
+// placer's held fee back. It returns how many orders expired.
+func (m *OrderModel) ExpireStaleOrders() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	orders, err := m.store.FindExpired(ctx, now)
 	if err != nil {
-		return []Order{}, err
+		return 0, err
 	}
-	defer cursor.Close(context.Background())
 
-	for cursor.Next(context.Background()) {
-		var order Order
-		if err := cursor.Decode(&order); err != nil {
-			return []Order{}, err
+	count := 0
+	for _, order := range orders {
+		var expired bool
+		change, err := newStatusChange(StatusNotAccepted, StatusExpired, primitive.NilObjectID, "not accepted in time")
+		if err != nil {
+			return count, err
+		}
+		change.At = now
+
+		err = m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			expired, err = m.store.Expire(ctx, order.OrderID, change)
+			if err != nil || !expired {
+				return err // lost the race to an accept, nothing to refund
+			}
+
+			return m.rewardsModel.releaseHold(ctx, order.OrderID)
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to expire order %s: %v", order.OrderID.Hex(), err)
+		}
+		if expired {
+			count++
 		}
-		orders = append(orders, order)
 	}
 
-	return orders, nil
+	return count, nil
+}
+
+// RunExpirySweeper calls ExpireStaleOrders every interval until ctx is done.
+func (m *OrderModel) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		count, err := m.ExpireStaleOrders()
+		if err != nil {
+			log.Printf("order expiry sweep failed: %v", err)
+		}
+		if count > 0 {
+			log.Printf("expired %d stale orders", count)
+		}
+	}
 }
 
-// accept order
-//requirements : userID, orderID, otp
-// check : userID==acceptedby, otp==otp, status=accepted,
-// todo : status=completed, reward--, reward++
+// GetAcceptedOrders returns one page of the orders userID accepted. An empty status means
+// the orders still in progress; a runner's finished deliveries are listed when asked for.
+func (m *OrderModel) GetAcceptedOrders(userID primitive.ObjectID, status string, q OrderQuery) ([]Order, *OrderCursor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	statuses := activeStatuses
+	if status != "" {
+		if !IsOrderStatus(status) {
+			return []Order{}, nil, fmt.Errorf("unknown status %q", status)
+		}
+		statuses = []string{status}
+	}
 
-func (m *OrderModel) CompleteOrder(userID, orderID primitive.ObjectID, otp string) error {
+	orders, err := m.store.FindAcceptedBy(ctx, userID, statuses, q.plusOne())
+	if err != nil {
+		return []Order{}, nil, err
+	}
+
+	orders, next := q.page(orders)
+	return orders, next, nil
+}
+
+// CompleteOrder verifies the OTP, marks the order Completed and pays the placer's held fee
+// to the runner. All writes share one transaction, and the status change is conditional
+// on the order still being Accepted, so a retried completion never pays twice. The
+// runner's bill starts the order's settlement, see ConfirmSettlement. It is required for
+// itemised orders and orders with a max spend, and may not exceed the max spend.
+func (m *OrderModel) CompleteOrder(userID, orderID primitive.ObjectID, otp string, bill *Bill) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Fetch the order from DB
-	var order Order
-	err := m.collection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&order)
+	order, err := m.store.FindByID(ctx, orderID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return fmt.Errorf("order not found")
+		if errors.Is(err, ErrNotFound) {
+			return ErrOrderNotFound
 		}
 		return fmt.Errorf("failed to fetch order: %v", err)
 	}
 
 	// Verify user is the one who accepted the order
 	if order.AcceptedBy != userID {
-		return fmt.Errorf("unauthorized: only the user who accepted the order can complete it")
+		return ErrNotRunner
 	}
 
-	// Verify order is in accepted state
-	if order.Status != "Accepted" {
-		return fmt.Errorf("order is not in accepted state")
+	// Verify order is on its way
+	if order.Status == StatusCompleted {
+		return ErrOrderCompleted
+	}
+	if order.Status != StatusAccepted && order.Status != StatusPickedUp {
+		return ErrOrderNotAccepted
+	}
+	change, err := newStatusChange(order.Status, StatusCompleted, userID, "")
+	if err != nil {
+		return err
 	}
 
 	// Verify OTP
@@ -289,26 +692,278 @@ func (m *OrderModel) CompleteOrder(userID, orderID primitive.ObjectID, otp strin
 		return fmt.Errorf("invalid OTP")
 	}
 
-	// Update order status to Completed
-	update := bson.M{
-		"$set": bson.M{"status": "Completed"},
+	// Without a bill there is nothing to hold against the items or the max spend
+	if bill == nil && (len(order.Items) > 0 || order.MaxSpend > 0) {
+		return ErrBillRequired
+	}
+
+	var settlement *Settlement
+	if bill != nil {
+		if order.MaxSpend > 0 && bill.Amount > order.MaxSpend {
+			return ErrOverMaxSpend
+		}
+		if bill.Amount < 0 {
+			return fmt.Errorf("bill amount cannot be negative")
+		}
+		if len(bill.ReceiptRef) > 500 {
+			return fmt.Errorf("receipt reference must be at most 500 characters")
+		}
+		settlement = &Settlement{
+			Estimated:   order.EstimatedTotal,
+			Actual:      bill.Amount,
+			ReceiptRef:  strings.TrimSpace(bill.ReceiptRef),
+			SubmittedAt: change.At,
+		}
+	}
+
+	return m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		// Update order status to Completed
+		if err := m.store.Complete(ctx, orderID, change, settlement); err != nil {
+			if errors.Is(err, ErrOrderCompleted) || errors.Is(err, ErrOrderNotAccepted) {
+				return err
+			}
+			return fmt.Errorf("failed to update order status: %v", err)
+		}
+
+		// Turn the fee held from PlacedBy into a payment to AcceptedBy
+		return m.rewardsModel.captureHold(ctx, orderID, order.PlacedBy, order.AcceptedBy)
+	})
+}
+
+// ConfirmSettlement lets the placer accept the runner's bill and say how they paid it
+// back. A placer who disagrees with the bill raises a dispute instead.
+func (m *OrderModel) ConfirmSettlement(userID, orderID primitive.ObjectID, paidVia string) (*Settlement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	paidVia = strings.ToLower(strings.TrimSpace(paidVia))
+	if paidVia != PaidViaCash && paidVia != PaidViaUPI {
+		return nil, fmt.Errorf("paid_via must be %s or %s", PaidViaCash, PaidViaUPI)
+	}
+
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order.PlacedBy != userID {
+		return nil, ErrNotPlacer
+	}
+	if order.Status != StatusCompleted {
+		return nil, ErrOrderNotCompleted
+	}
+	if order.Settlement == nil {
+		return nil, ErrNoSettlement
+	}
+	if order.Settlement.ConfirmedAt != nil {
+		return nil, ErrSettlementDone
+	}
+
+	now := time.Now()
+	if err := m.store.ConfirmSettlement(ctx, orderID, paidVia, now); err != nil {
+		return nil, err
+	}
+
+	settlement := *order.Settlement
+	settlement.PaidVia = paidVia
+	settlement.ConfirmedAt = &now
+	return &settlement, nil
+}
+
+// PickUpOrder records that the runner has bought the items and is on the way.
+func (m *OrderModel) PickUpOrder(userID, orderID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.AcceptedBy != userID {
+		return ErrNotRunner
+	}
+
+	return m.changeStatus(ctx, order, StatusPickedUp, userID, "")
+}
+
+// DisputeOrder flags the order for review. Either party may raise a dispute, and must say why.
+func (m *OrderModel) DisputeOrder(userID, orderID primitive.ObjectID, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("a reason is required to raise a dispute")
+	}
+
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if !order.isParty(userID) {
+		return ErrNotOrderParty
+	}
+
+	return m.changeStatus(ctx, order, StatusDisputed, userID, reason)
+}
+
+// ResolveDispute lets an admin settle a disputed order as Completed or Cancelled. Until
+// then the placer's fee stays where the dispute found it, so the coins move here, in the
+// same transaction as the status change:
+//   - disputed before completion, the fee is still held: Completed pays it to the runner
+//     and Cancelled refunds it to the placer;
+//   - disputed after completion, the fee was already paid: Completed leaves it there and
+//     Cancelled takes it back from the runner.
+func (m *OrderModel) ResolveDispute(adminID, orderID primitive.ObjectID, resolution, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return fmt.Errorf("a reason is required to resolve a dispute")
+	}
+	if resolution != StatusCompleted && resolution != StatusCancelled {
+		return fmt.Errorf("resolution must be %s or %s", StatusCompleted, StatusCancelled)
+	}
+
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != StatusDisputed {
+		return ErrOrderNotDisputed
+	}
+	change, err := newStatusChange(StatusDisputed, resolution, adminID, reason)
+	if err != nil {
+		return err
+	}
+
+	feePaid := order.disputedFrom() == StatusCompleted
+
+	return m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if resolution == StatusCancelled {
+			if err := m.store.Cancel(ctx, orderID, change); err != nil {
+				return err
+			}
+			if feePaid {
+				return m.rewardsModel.refundPaidFee(ctx, orderID, order.AcceptedBy, order.PlacedBy)
+			}
+			return m.rewardsModel.releaseHold(ctx, orderID)
+		}
+
+		if err := m.store.ChangeStatus(ctx, orderID, change); err != nil {
+			return err
+		}
+		if feePaid {
+			return nil
+		}
+		return m.rewardsModel.captureHold(ctx, orderID, order.PlacedBy, order.AcceptedBy)
+	})
+}
+
+// disputedFrom returns the status the order was in when it was last disputed.
+func (o *Order) disputedFrom() string {
+	for i := len(o.History) - 1; i >= 0; i-- {
+		if o.History[i].To == StatusDisputed {
+			return o.History[i].From
+		}
+	}
+	return ""
+}
+
+// GetOrderHistory returns the status changes of the order, oldest first. Only the placer
+// and the runner may see it.
+func (m *OrderModel) GetOrderHistory(userID, orderID primitive.ObjectID) ([]StatusChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if !order.isParty(userID) {
+		return nil, ErrNotOrderParty
+	}
+
+	if order.History == nil {
+		return []StatusChange{}, nil
 	}
-	_, err = m.collection.UpdateOne(ctx, bson.M{"_id": orderID}, update)
+	return order.History, nil
+}
+
+// GetOrderDetail returns one order as userID may see it. The placer and the runner see
+// the whole order; anyone else only sees an order that is still open for acceptance, the
+// same as in the feed, and gets ErrNotOrderParty for the rest.
+func (m *OrderModel) GetOrderDetail(userID, orderID primitive.ObjectID) (*OrderDetail, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	order, err := m.findOrder(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("failed to update order status: %v", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	isOpen := order.Status == StatusNotAccepted && order.ExpiresAt.After(now)
+
+	detail := &OrderDetail{
+		Order:      order.ViewFor(userID),
+		AgeSeconds: int64(now.Sub(order.CreatedAt) / time.Second),
+	}
+	switch {
+	case order.PlacedBy == userID:
+		detail.Role = RolePlacer
+	case order.isParty(userID):
+		detail.Role = RoleRunner
+	case isOpen:
+		detail.Role = RoleViewer
+	default:
+		return nil, ErrNotOrderParty
 	}
 
-	// Decrease 10 coins from PlacedBy
-	_, err = m.rewardsModel.UpdateCoins(order.PlacedBy, -10)
+	if detail.Role != RoleViewer {
+		detail.History = order.History
+	}
+	if isOpen {
+		expiresIn := int64(order.ExpiresAt.Sub(now) / time.Second)
+		detail.ExpiresInSeconds = &expiresIn
+	}
+
+	detail.Placer, err = publicProfile(ctx, m.userStore, m.store, userID, order.PlacedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch placer: %v", err)
+	}
+	if !order.AcceptedBy.IsZero() {
+		detail.Runner, err = publicProfile(ctx, m.userStore, m.store, userID, order.AcceptedBy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch runner: %v", err)
+		}
+	}
+
+	return detail, nil
+}
+
+func (m *OrderModel) findOrder(ctx context.Context, orderID primitive.ObjectID) (*Order, error) {
+	order, err := m.store.FindByID(ctx, orderID)
 	if err != nil {
-		return fmt.Errorf("failed to deduct coins from order creator: %v", err)
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch order: %v", err)
 	}
+	return order, nil
+}
 
-	// Increase 10 coins to AcceptedBy
-	_, err = m.rewardsModel.UpdateCoins(order.AcceptedBy, 10)
+// changeStatus moves order to status for transitions that need no other field changed.
+func (m *OrderModel) changeStatus(ctx context.Context, order *Order, status string, by primitive.ObjectID, reason string) error {
+	change, err := newStatusChange(order.Status, status, by, reason)
 	if err != nil {
-		return fmt.Errorf("failed to add coins to order accepter: %v", err)
+		return err
 	}
 
-	return nil
+	return m.store.ChangeStatus(ctx, order.OrderID, change)
+}
+
+// isParty reports whether userID placed or accepted the order.
+func (o *Order) isParty(userID primitive.ObjectID) bool {
+	return o.PlacedBy == userID || (!o.AcceptedBy.IsZero() && o.AcceptedBy == userID)
 }
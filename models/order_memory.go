@@ -0,0 +1,325 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryOrderStore is the in-memory implementation of OrderStore.
+type MemoryOrderStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryOrderStore(db *MemoryDB) *MemoryOrderStore {
+	return &MemoryOrderStore{db: db}
+}
+
+func (s *MemoryOrderStore) Insert(ctx context.Context, order *Order) error {
+	defer s.db.lock(ctx)()
+
+	for _, existing := range s.db.orders {
+		if existing.CustomOrderID == order.CustomOrderID {
+			return &DuplicateError{Field: "custom_order_id"}
+		}
+	}
+
+	if order.OrderID.IsZero() {
+		order.OrderID = primitive.NewObjectID()
+	}
+	s.db.orders[order.OrderID] = *order
+	return nil
+}
+
+func (s *MemoryOrderStore) FindByID(ctx context.Context, id primitive.ObjectID) (*Order, error) {
+	defer s.db.rlock(ctx)()
+
+	order, ok := s.db.orders[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &order, nil
+}
+
+func (s *MemoryOrderStore) FindOpen(ctx context.Context, excludeUserID primitive.ObjectID, now time.Time, q OrderQuery) ([]Order, error) {
+	return s.list(ctx, q, func(o *Order) bool {
+		return o.PlacedBy != excludeUserID && o.Status == StatusNotAccepted && o.ExpiresAt.After(now)
+	}), nil
+}
+
+func (s *MemoryOrderStore) FindByPlacer(ctx context.Context, userID primitive.ObjectID, statuses []string, q OrderQuery) ([]Order, error) {
+	return s.list(ctx, q, func(o *Order) bool {
+		return o.PlacedBy == userID && slices.Contains(statuses, o.Status)
+	}), nil
+}
+
+func (s *MemoryOrderStore) FindAcceptedBy(ctx context.Context, userID primitive.ObjectID, statuses []string, q OrderQuery) ([]Order, error) {
+	return s.list(ctx, q, func(o *Order) bool {
+		return o.AcceptedBy == userID && slices.Contains(statuses, o.Status)
+	}), nil
+}
+
+func (s *MemoryOrderStore) Accept(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.PlacedBy == change.By {
+		return ErrOwnOrder
+	}
+	if order.Status == StatusExpired || (order.Status == StatusNotAccepted && !order.ExpiresAt.After(change.At)) {
+		return ErrOrderExpired
+	}
+	if order.Status != change.From {
+		return acceptError(order.Status)
+	}
+	order.AcceptedBy = change.By
+	s.db.orders[orderID] = withStatus(order, change)
+	return nil
+}
+
+func (s *MemoryOrderStore) Complete(ctx context.Context, orderID primitive.ObjectID, change StatusChange, settlement *Settlement) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status == StatusCompleted {
+		return ErrOrderCompleted
+	}
+	if order.Status != change.From || order.AcceptedBy != change.By {
+		return ErrOrderNotAccepted
+	}
+	if settlement != nil {
+		order.Settlement = settlement
+	}
+	s.db.orders[orderID] = withStatus(order, change)
+	return nil
+}
+
+func (s *MemoryOrderStore) ConfirmSettlement(ctx context.Context, orderID primitive.ObjectID, paidVia string, at time.Time) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != StatusCompleted || order.Settlement == nil || order.Settlement.ConfirmedAt != nil {
+		return ErrSettlementDone
+	}
+
+	// Copy rather than update in place: transaction snapshots share the pointer
+	settlement := *order.Settlement
+	settlement.PaidVia = paidVia
+	settlement.ConfirmedAt = &at
+	order.Settlement = &settlement
+	s.db.orders[orderID] = order
+	return nil
+}
+
+func (s *MemoryOrderStore) ChangeStatus(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != change.From {
+		return ErrOrderStatusChanged
+	}
+	s.db.orders[orderID] = withStatus(order, change)
+	return nil
+}
+
+func (s *MemoryOrderStore) FindExpired(ctx context.Context, now time.Time) ([]Order, error) {
+	return s.find(ctx, func(o *Order) bool {
+		return o.Status == StatusNotAccepted && !o.ExpiresAt.After(now)
+	}), nil
+}
+
+func (s *MemoryOrderStore) Expire(ctx context.Context, orderID primitive.ObjectID, change StatusChange) (bool, error) {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok || order.Status != change.From || order.ExpiresAt.After(change.At) {
+		return false, nil
+	}
+	s.db.orders[orderID] = withStatus(order, change)
+	return true, nil
+}
+
+func (s *MemoryOrderStore) RequestCancel(ctx context.Context, orderID primitive.ObjectID, request CancelRequest) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != StatusAccepted {
+		return ErrOrderStatusChanged
+	}
+	order.CancelRequest = &request
+	s.db.orders[orderID] = order
+	return nil
+}
+
+func (s *MemoryOrderStore) Cancel(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != change.From {
+		return ErrOrderStatusChanged
+	}
+	at := change.At
+	order.CancelledAt = &at
+	order.CancelReason = change.Reason
+	order.CancelRequest = nil
+	s.db.orders[orderID] = withStatus(order, change)
+	return nil
+}
+
+func (s *MemoryOrderStore) Release(ctx context.Context, orderID primitive.ObjectID, change StatusChange, expiresAt time.Time) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != change.From || order.AcceptedBy != change.By {
+		return ErrOrderStatusChanged
+	}
+	order.AcceptedBy = primitive.NilObjectID
+	order.ExpiresAt = expiresAt
+	order.CancelRequest = nil
+	s.db.orders[orderID] = withStatus(order, change)
+	return nil
+}
+
+func (s *MemoryOrderStore) CountReleasesBy(ctx context.Context, runnerID primitive.ObjectID, since time.Time) (int64, error) {
+	defer s.db.rlock(ctx)()
+
+	var count int64
+	for _, order := range s.db.orders {
+		for _, change := range order.History {
+			if change.From == StatusAccepted && change.To == StatusNotAccepted &&
+				change.By == runnerID && !change.At.Before(since) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryOrderStore) CountCompletedBy(ctx context.Context, runnerID primitive.ObjectID) (int64, error) {
+	orders := s.find(ctx, func(o *Order) bool {
+		return o.AcceptedBy == runnerID && o.Status == StatusCompleted
+	})
+	return int64(len(orders)), nil
+}
+
+func (s *MemoryOrderStore) Rate(ctx context.Context, orderID primitive.ObjectID, role string, rater primitive.ObjectID, rating Rating) error {
+	defer s.db.lock(ctx)()
+
+	order, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if order.Status != StatusCompleted {
+		return ErrOrderStatusChanged
+	}
+
+	switch {
+	case role == RolePlacer && order.PlacedBy == rater:
+		if order.RunnerRating != nil {
+			return ErrAlreadyRated
+		}
+		order.RunnerRating = &rating
+	case role == RoleRunner && order.AcceptedBy == rater:
+		if order.PlacerRating != nil {
+			return ErrAlreadyRated
+		}
+		order.PlacerRating = &rating
+	default:
+		return ErrOrderStatusChanged
+	}
+	s.db.orders[orderID] = order
+	return nil
+}
+
+func (s *MemoryOrderStore) RatingsOf(ctx context.Context, userID primitive.ObjectID) (Ratings, error) {
+	defer s.db.rlock(ctx)()
+
+	var runnerStars, runnerCount, placerStars, placerCount int64
+	for _, order := range s.db.orders {
+		if order.AcceptedBy == userID && order.RunnerRating != nil {
+			runnerStars += int64(order.RunnerRating.Stars)
+			runnerCount++
+		}
+		if order.PlacedBy == userID && order.PlacerRating != nil {
+			placerStars += int64(order.PlacerRating.Stars)
+			placerCount++
+		}
+	}
+
+	return Ratings{
+		AsRunner: summarise(runnerStars, runnerCount),
+		AsPlacer: summarise(placerStars, placerCount),
+	}, nil
+}
+
+func (s *MemoryOrderStore) SharesActiveOrder(ctx context.Context, a, b primitive.ObjectID) (bool, error) {
+	orders := s.find(ctx, func(o *Order) bool {
+		return slices.Contains(activeStatuses, o.Status) &&
+			((o.PlacedBy == a && o.AcceptedBy == b) || (o.PlacedBy == b && o.AcceptedBy == a))
+	})
+	return len(orders) > 0, nil
+}
+
+// withStatus applies change to order. The history is copied rather than appended in
+// place, since transaction snapshots share the old backing array.
+func withStatus(order Order, change StatusChange) Order {
+	order.Status = change.To
+	order.History = append(slices.Clip(order.History), change)
+	return order
+}
+
+// list returns the page of orders that match and pass q's filters.
+func (s *MemoryOrderStore) list(ctx context.Context, q OrderQuery, match func(*Order) bool) []Order {
+	orders := s.find(ctx, func(o *Order) bool {
+		return match(o) && q.matches(o) && (q.After == nil || q.before(*q.After, *q.cursorFor(*o)))
+	})
+
+	sort.Slice(orders, func(i, j int) bool {
+		return q.before(*q.cursorFor(orders[i]), *q.cursorFor(orders[j]))
+	})
+	if q.Limit > 0 && len(orders) > q.Limit {
+		orders = orders[:q.Limit]
+	}
+	return orders
+}
+
+// find returns the matching orders oldest first, which is what Mongo's natural order gives in practice.
+func (s *MemoryOrderStore) find(ctx context.Context, match func(*Order) bool) []Order {
+	defer s.db.rlock(ctx)()
+
+	var orders []Order
+	for _, order := range s.db.orders {
+		if match(&order) {
+			orders = append(orders, order)
+		}
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+	return orders
+}
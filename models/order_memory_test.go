@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestAcceptOrderConcurrently races runners for one order: exactly one may win.
+func TestAcceptOrderConcurrently(t *testing.T) {
+	db := NewMemoryDB()
+	store := NewMemoryOrderStore(db)
+	model := NewOrderModel(store, NewMemoryUserStore(db), nil, nil, db, OrderExpiry{}, ReleasePolicy{}, nil)
+
+	ctx := context.Background()
+	now := time.Now()
+	order := &Order{
+		OrderID:   primitive.NewObjectID(),
+		Store:     "Amul",
+		Status:    StatusNotAccepted,
+		PlacedBy:  primitive.NewObjectID(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+		History:   []StatusChange{{To: StatusNotAccepted, At: now}},
+	}
+	if err := store.Insert(ctx, order); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+
+	const runners = 50
+	ids := make([]primitive.ObjectID, runners)
+	errs := make([]error, runners)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range runners {
+		ids[i] = primitive.NewObjectID()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = model.AcceptOrder(ids[i], order.OrderID)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	var winner primitive.ObjectID
+	wins := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			wins++
+			winner = ids[i]
+		case !errors.Is(err, ErrOrderAlreadyTaken):
+			t.Errorf("runner %d: got %v, want nil or ErrOrderAlreadyTaken", i, err)
+		}
+	}
+	if wins != 1 {
+		t.Fatalf("%d runners accepted the order, want 1", wins)
+	}
+
+	stored, err := store.FindByID(ctx, order.OrderID)
+	if err != nil {
+		t.Fatalf("find order: %v", err)
+	}
+	if stored.Status != StatusAccepted {
+		t.Errorf("status = %s, want %s", stored.Status, StatusAccepted)
+	}
+	if stored.AcceptedBy != winner {
+		t.Errorf("accepted_by = %s, want the winner %s", stored.AcceptedBy.Hex(), winner.Hex())
+	}
+
+	accepted := 0
+	for _, change := range stored.History {
+		if change.To == StatusAccepted {
+			accepted++
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("history has %d Accepted entries, want 1", accepted)
+	}
+}
@@ -0,0 +1,479 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoOrderStore is the MongoDB implementation of OrderStore.
+type MongoOrderStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOrderStore(collection *mongo.Collection) *MongoOrderStore {
+	return &MongoOrderStore{collection: collection}
+}
+
+func (s *MongoOrderStore) Insert(ctx context.Context, order *Order) error {
+	result, err := s.collection.InsertOne(ctx, order)
+	if err != nil {
+		return mongoErr(err)
+	}
+
+	order.OrderID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *MongoOrderStore) FindByID(ctx context.Context, id primitive.ObjectID) (*Order, error) {
+	var order Order
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+
+	return &order, nil
+}
+
+func (s *MongoOrderStore) FindOpen(ctx context.Context, excludeUserID primitive.ObjectID, now time.Time, q OrderQuery) ([]Order, error) {
+	filter := bson.M{
+		"placed_by":  bson.M{"$ne": excludeUserID}, // ne : not equal
+		"status":     StatusNotAccepted,
+		"expires_at": bson.M{"$gt": now},
+	}
+
+	return s.list(ctx, filter, q)
+}
+
+func (s *MongoOrderStore) FindByPlacer(ctx context.Context, userID primitive.ObjectID, statuses []string, q OrderQuery) ([]Order, error) {
+	filter := bson.M{
+		"placed_by": userID,
+		"status":    bson.M{"$in": statuses},
+	}
+
+	return s.list(ctx, filter, q)
+}
+
+func (s *MongoOrderStore) FindAcceptedBy(ctx context.Context, userID primitive.ObjectID, statuses []string, q OrderQuery) ([]Order, error) {
+	filter := bson.M{
+		"accepted_by": userID,
+		"status":      bson.M{"$in": statuses},
+	}
+
+	return s.list(ctx, filter, q)
+}
+
+func (s *MongoOrderStore) Accept(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error {
+	filter := bson.M{
+		"_id":        orderID,
+		"status":     change.From,
+		"placed_by":  bson.M{"$ne": change.By},
+		"expires_at": bson.M{"$gt": change.At},
+	}
+	update := statusUpdate(change, bson.M{"accepted_by": change.By})
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	// The filter did not match: work out why so the caller can respond precisely
+	order, err := s.FindByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.PlacedBy == change.By {
+		return ErrOwnOrder
+	}
+	if order.Status == StatusExpired || order.Status == StatusNotAccepted {
+		return ErrOrderExpired
+	}
+	return acceptError(order.Status)
+}
+
+func (s *MongoOrderStore) Complete(ctx context.Context, orderID primitive.ObjectID, change StatusChange, settlement *Settlement) error {
+	filter := bson.M{
+		"_id":         orderID,
+		"accepted_by": change.By,
+		"status":      change.From,
+	}
+	set := bson.M{}
+	if settlement != nil {
+		set["settlement"] = settlement
+	}
+	update := statusUpdate(change, set)
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	order, err := s.FindByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status == StatusCompleted {
+		return ErrOrderCompleted
+	}
+	return ErrOrderNotAccepted
+}
+
+func (s *MongoOrderStore) ConfirmSettlement(ctx context.Context, orderID primitive.ObjectID, paidVia string, at time.Time) error {
+	filter := bson.M{
+		"_id":                     orderID,
+		"status":                  StatusCompleted,
+		"settlement":              bson.M{"$type": "object"},
+		"settlement.confirmed_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"settlement.paid_via":     paidVia,
+			"settlement.confirmed_at": at,
+		},
+	}
+
+	err := s.conditionalUpdate(ctx, orderID, filter, update)
+	if errors.Is(err, ErrOrderStatusChanged) {
+		return ErrSettlementDone
+	}
+	return err
+}
+
+func (s *MongoOrderStore) ChangeStatus(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error {
+	filter := bson.M{
+		"_id":    orderID,
+		"status": change.From,
+	}
+
+	return s.conditionalUpdate(ctx, orderID, filter, statusUpdate(change, nil))
+}
+
+// conditionalUpdate applies update if filter matches. Otherwise it returns ErrNotFound if
+// the order is gone and ErrOrderStatusChanged if it has moved on.
+func (s *MongoOrderStore) conditionalUpdate(ctx context.Context, orderID primitive.ObjectID, filter, update bson.M) error {
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	if _, err := s.FindByID(ctx, orderID); err != nil {
+		return err
+	}
+	return ErrOrderStatusChanged
+}
+
+func (s *MongoOrderStore) FindExpired(ctx context.Context, now time.Time) ([]Order, error) {
+	filter := bson.M{
+		"status":     StatusNotAccepted,
+		"expires_at": bson.M{"$lte": now},
+	}
+
+	return s.find(ctx, filter)
+}
+
+func (s *MongoOrderStore) Expire(ctx context.Context, orderID primitive.ObjectID, change StatusChange) (bool, error) {
+	filter := bson.M{
+		"_id":        orderID,
+		"status":     change.From,
+		"expires_at": bson.M{"$lte": change.At},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, statusUpdate(change, nil))
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (s *MongoOrderStore) RequestCancel(ctx context.Context, orderID primitive.ObjectID, request CancelRequest) error {
+	filter := bson.M{
+		"_id":    orderID,
+		"status": StatusAccepted,
+	}
+	update := bson.M{
+		"$set": bson.M{"cancel_request": request},
+	}
+
+	return s.conditionalUpdate(ctx, orderID, filter, update)
+}
+
+func (s *MongoOrderStore) Cancel(ctx context.Context, orderID primitive.ObjectID, change StatusChange) error {
+	filter := bson.M{
+		"_id":    orderID,
+		"status": change.From,
+	}
+	update := statusUpdate(change, bson.M{
+		"cancelled_at":  change.At,
+		"cancel_reason": change.Reason,
+	})
+	update["$unset"] = bson.M{"cancel_request": ""}
+
+	return s.conditionalUpdate(ctx, orderID, filter, update)
+}
+
+func (s *MongoOrderStore) Release(ctx context.Context, orderID primitive.ObjectID, change StatusChange, expiresAt time.Time) error {
+	filter := bson.M{
+		"_id":         orderID,
+		"status":      change.From,
+		"accepted_by": change.By,
+	}
+	update := statusUpdate(change, bson.M{
+		"accepted_by": primitive.NilObjectID,
+		"expires_at":  expiresAt,
+	})
+	update["$unset"] = bson.M{"cancel_request": ""}
+
+	return s.conditionalUpdate(ctx, orderID, filter, update)
+}
+
+func (s *MongoOrderStore) CountReleasesBy(ctx context.Context, runnerID primitive.ObjectID, since time.Time) (int64, error) {
+	release := bson.M{
+		"history.from": StatusAccepted,
+		"history.to":   StatusNotAccepted,
+		"history.by":   runnerID,
+		"history.at":   bson.M{"$gte": since},
+	}
+	pipeline := mongo.Pipeline{
+		// Only unwind the histories of orders the runner released at least once
+		{{Key: "$match", Value: bson.M{"history": bson.M{"$elemMatch": bson.M{
+			"from": StatusAccepted,
+			"to":   StatusNotAccepted,
+			"by":   runnerID,
+			"at":   bson.M{"$gte": since},
+		}}}}},
+		{{Key: "$unwind", Value: "$history"}},
+		{{Key: "$match", Value: release}},
+		{{Key: "$count", Value: "releases"}},
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		Releases int64 `bson:"releases"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+
+	return result.Releases, cursor.Err()
+}
+
+func (s *MongoOrderStore) CountCompletedBy(ctx context.Context, runnerID primitive.ObjectID) (int64, error) {
+	filter := bson.M{
+		"accepted_by": runnerID,
+		"status":      StatusCompleted,
+	}
+
+	return s.collection.CountDocuments(ctx, filter)
+}
+
+func (s *MongoOrderStore) Rate(ctx context.Context, orderID primitive.ObjectID, role string, rater primitive.ObjectID, rating Rating) error {
+	// The placer rates the runner and the runner rates the placer
+	party, field := "placed_by", "runner_rating"
+	if role == RoleRunner {
+		party, field = "accepted_by", "placer_rating"
+	}
+
+	filter := bson.M{
+		"_id":    orderID,
+		"status": StatusCompleted,
+		party:    rater,
+		field:    bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{field: rating}}
+
+	err := s.conditionalUpdate(ctx, orderID, filter, update)
+	if errors.Is(err, ErrOrderStatusChanged) {
+		return ErrAlreadyRated
+	}
+	return err
+}
+
+func (s *MongoOrderStore) RatingsOf(ctx context.Context, userID primitive.ObjectID) (Ratings, error) {
+	// A user never accepts their own order, so each matching order counts in one role only
+	asRunner := bson.M{"$eq": bson.A{"$accepted_by", userID}}
+	cursor, err := s.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"accepted_by": userID, "runner_rating": bson.M{"$exists": true}},
+			bson.M{"placed_by": userID, "placer_rating": bson.M{"$exists": true}},
+		}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          nil,
+			"runner_stars": bson.M{"$sum": bson.M{"$cond": bson.A{asRunner, "$runner_rating.stars", 0}}},
+			"runner_count": bson.M{"$sum": bson.M{"$cond": bson.A{asRunner, 1, 0}}},
+			"placer_stars": bson.M{"$sum": bson.M{"$cond": bson.A{asRunner, 0, "$placer_rating.stars"}}},
+			"placer_count": bson.M{"$sum": bson.M{"$cond": bson.A{asRunner, 0, 1}}},
+		}}},
+	})
+	if err != nil {
+		return Ratings{}, err
+	}
+
+	var totals []struct {
+		RunnerStars int64 `bson:"runner_stars"`
+		RunnerCount int64 `bson:"runner_count"`
+		PlacerStars int64 `bson:"placer_stars"`
+		PlacerCount int64 `bson:"placer_count"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil || len(totals) == 0 {
+		return Ratings{}, err
+	}
+
+	t := totals[0]
+	return Ratings{
+		AsRunner: summarise(t.RunnerStars, t.RunnerCount),
+		AsPlacer: summarise(t.PlacerStars, t.PlacerCount),
+	}, nil
+}
+
+func (s *MongoOrderStore) SharesActiveOrder(ctx context.Context, a, b primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"status": bson.M{"$in": activeStatuses},
+		"$or": bson.A{
+			bson.M{"placed_by": a, "accepted_by": b},
+			bson.M{"placed_by": b, "accepted_by": a},
+		},
+	}
+
+	count, err := s.collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// statusUpdate sets the new status, and any other fields in set, and records change in the history.
+func statusUpdate(change StatusChange, set bson.M) bson.M {
+	if set == nil {
+		set = bson.M{}
+	}
+	set["status"] = change.To
+
+	return bson.M{
+		"$set":  set,
+		"$push": bson.M{"history": change},
+	}
+}
+
+// list adds q's filters to filter and returns the page of orders it selects.
+func (s *MongoOrderStore) list(ctx context.Context, filter bson.M, q OrderQuery) ([]Order, error) {
+	if q.Store != "" {
+		filter["store"] = bson.M{"$regex": "^" + regexp.QuoteMeta(q.Store) + "$", "$options": "i"}
+	}
+	if q.Hostel != "" {
+		filter["hostel"] = q.Hostel
+	}
+
+	if q.distances != nil {
+		return s.listNearby(ctx, filter, q)
+	}
+
+	direction, after := 1, "$gt"
+	if q.Newest {
+		direction, after = -1, "$lt"
+	}
+	if q.After != nil {
+		filter["$or"] = bson.A{
+			bson.M{"created_at": bson.M{after: q.After.CreatedAt}},
+			bson.M{"created_at": q.After.CreatedAt, "_id": bson.M{after: q.After.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: direction}, {Key: "_id", Value: direction}})
+	if q.Limit > 0 {
+		opts.SetLimit(int64(q.Limit))
+	}
+
+	return s.find(ctx, filter, opts)
+}
+
+// listNearby is list for Nearby queries: each order's distance from the caller's hostel
+// is worked out in the pipeline and sorted on before the age.
+func (s *MongoOrderStore) listNearby(ctx context.Context, filter bson.M, q OrderQuery) ([]Order, error) {
+	branches := bson.A{}
+	for hostel, d := range q.distances {
+		branches = append(branches, bson.M{"case": bson.M{"$eq": bson.A{"$hostel", hostel}}, "then": d})
+	}
+	distance := bson.M{"$switch": bson.M{"branches": branches, "default": unknownDistance}}
+	if len(branches) == 0 {
+		distance = bson.M{"$literal": unknownDistance} // $switch needs at least one branch
+	}
+
+	direction, after := 1, "$gt"
+	if q.Newest {
+		direction, after = -1, "$lt"
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"distance": distance}}},
+	}
+	if q.After != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"distance": bson.M{"$gt": q.After.Distance}},
+			bson.M{"distance": q.After.Distance, "created_at": bson.M{after: q.After.CreatedAt}},
+			bson.M{"distance": q.After.Distance, "created_at": q.After.CreatedAt, "_id": bson.M{after: q.After.ID}},
+		}}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: bson.D{
+		{Key: "distance", Value: 1}, {Key: "created_at", Value: direction}, {Key: "_id", Value: direction},
+	}}})
+	if q.Limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: q.Limit}})
+	}
+
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var orders []Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (s *MongoOrderStore) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]Order, error) {
+	var orders []Order
+
+	cursor, err := s.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var order Order
+		if err := cursor.Decode(&order); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+
+	return orders, cursor.Err()
+}
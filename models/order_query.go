@@ -0,0 +1,130 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OrderQuery narrows and pages an order list. Lists are sorted by CreatedAt, with the
+// order ID breaking ties, so a cursor always points at one exact position.
+type OrderQuery struct {
+	Store  string // matched case-insensitively; empty means any store
+	Hostel string // the placer's hostel; empty means any hostel
+	Newest bool   // newest first instead of oldest first
+	Nearby bool   // nearest hostel first, then by CreatedAt; only the feed supports it
+	After  *OrderCursor
+	Limit  int // 0 means no limit
+
+	// distances from the caller's hostel, set by OrderModel when Nearby is asked for
+	distances map[string]int
+}
+
+// OrderCursor is the position of the last order on a page.
+type OrderCursor struct {
+	Distance  int // only used by Nearby lists
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorFor returns the cursor that continues the list after order.
+func (q OrderQuery) cursorFor(order Order) *OrderCursor {
+	cursor := &OrderCursor{CreatedAt: order.CreatedAt, ID: order.OrderID}
+	if q.distances != nil {
+		cursor.Distance = q.distanceTo(order.Hostel)
+	}
+	return cursor
+}
+
+// distanceTo returns how far hostel is from the caller's.
+func (q OrderQuery) distanceTo(hostel string) int {
+	if d, ok := q.distances[hostel]; ok {
+		return d
+	}
+	return unknownDistance
+}
+
+// String encodes the cursor for use in a URL. Clients treat it as opaque.
+func (c OrderCursor) String() string {
+	raw := strconv.Itoa(c.Distance) + "." + strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "." + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseOrderCursor decodes a cursor made by OrderCursor.String.
+func ParseOrderCursor(s string) (*OrderCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidCursor
+	}
+	distance, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &OrderCursor{Distance: distance, CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+}
+
+// matches reports whether order passes the query's filters. It ignores paging.
+func (q OrderQuery) matches(order *Order) bool {
+	if q.Store != "" && !strings.EqualFold(order.Store, q.Store) {
+		return false
+	}
+	if q.Hostel != "" && order.Hostel != q.Hostel {
+		return false
+	}
+	return true
+}
+
+// before reports whether a sorts before b in the query's order. Distance always sorts
+// nearest first; Newest only reverses the order by age.
+func (q OrderQuery) before(a, b OrderCursor) bool {
+	if a.Distance != b.Distance {
+		return a.Distance < b.Distance
+	}
+
+	less := a.CreatedAt.Before(b.CreatedAt) ||
+		(a.CreatedAt.Equal(b.CreatedAt) && a.ID.Hex() < b.ID.Hex())
+	if q.Newest {
+		equal := a.CreatedAt.Equal(b.CreatedAt) && a.ID == b.ID
+		return !less && !equal
+	}
+	return less
+}
+
+// plusOne asks for one order more than the page holds, to learn whether another page follows.
+func (q OrderQuery) plusOne() OrderQuery {
+	if q.Limit > 0 {
+		q.Limit++
+	}
+	return q
+}
+
+// page trims the one order more than q.Limit that the store was asked for, and returns the
+// cursor of the next page, or nil if this is the last.
+func (q OrderQuery) page(orders []Order) ([]Order, *OrderCursor) {
+	if q.Limit == 0 || len(orders) <= q.Limit {
+		return orders, nil
+	}
+
+	orders = orders[:q.Limit]
+	return orders, q.cursorFor(orders[q.Limit-1])
+}
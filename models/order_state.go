@@ -0,0 +1,80 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Order statuses.
+const (
+	StatusNotAccepted = "NotAccepted"
+	StatusAccepted    = "Accepted"
+	StatusPickedUp    = "PickedUp"
+	StatusCompleted   = "Completed"
+	StatusCancelled   = "Cancelled"
+	StatusExpired     = "Expired"
+	StatusDisputed    = "Disputed"
+)
+
+// orderStatuses lists every status, in lifecycle order.
+var orderStatuses = []string{
+	StatusNotAccepted, StatusAccepted, StatusPickedUp, StatusCompleted,
+	StatusCancelled, StatusExpired, StatusDisputed,
+}
+
+// IsOrderStatus reports whether status is one of the order statuses.
+func IsOrderStatus(status string) bool {
+	return slices.Contains(orderStatuses, status)
+}
+
+// orderTransitions lists, for every status, the statuses an order may move to next.
+// Cancelled and Expired are final. Accepted goes back to NotAccepted when the runner releases the order.
+// Only an admin moves an order out of Disputed, see OrderModel.ResolveDispute.
+var orderTransitions = map[string][]string{
+	StatusNotAccepted: {StatusAccepted, StatusCancelled, StatusExpired},
+	StatusAccepted:    {StatusNotAccepted, StatusPickedUp, StatusCompleted, StatusCancelled, StatusDisputed},
+	StatusPickedUp:    {StatusCompleted, StatusDisputed},
+	StatusCompleted:   {StatusDisputed},
+	StatusDisputed:    {StatusCompleted, StatusCancelled},
+}
+
+// activeStatuses are the states in which placer and runner still need to reach each other.
+var activeStatuses = []string{StatusAccepted, StatusPickedUp, StatusDisputed}
+
+var (
+	ErrInvalidTransition  = errors.New("invalid status change")
+	ErrOrderStatusChanged = errors.New("order status changed in the meantime, try again")
+)
+
+// acceptError tells a runner who could not accept an order in status whether they lost
+// the race to another runner or the order is closed.
+func acceptError(status string) error {
+	if status == StatusAccepted || status == StatusPickedUp {
+		return ErrOrderAlreadyTaken
+	}
+	return ErrOrderClosed
+}
+
+// StatusChange is one entry in an order's status history. By is zero for changes the
+// system makes on its own, such as expiry.
+type StatusChange struct {
+	From   string             `bson:"from" json:"from,omitempty"`
+	To     string             `bson:"to" json:"to"`
+	By     primitive.ObjectID `bson:"by" json:"by"`
+	At     time.Time          `bson:"at" json:"at"`
+	Reason string             `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// newStatusChange is the single place that decides whether an order may go from one
+// status to another. Every status write goes through it.
+func newStatusChange(from, to string, by primitive.ObjectID, reason string) (StatusChange, error) {
+	if !slices.Contains(orderTransitions[from], to) {
+		return StatusChange{}, fmt.Errorf("%w: order is %s and cannot become %s", ErrInvalidTransition, from, to)
+	}
+
+	return StatusChange{From: from, To: to, By: by, At: time.Now(), Reason: reason}, nil
+}
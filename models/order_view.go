@@ -0,0 +1,50 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// ViewFor returns the order as viewer is allowed to see it. The OTP proves delivery, so
+// only the placer sees it; the placer's phone and the settlement are shared with the
+// runner who accepted.
+func (o Order) ViewFor(viewer primitive.ObjectID) Order {
+	isPlacer := o.PlacedBy == viewer
+	isRunner := !o.AcceptedBy.IsZero() && o.AcceptedBy == viewer
+
+	if !isPlacer {
+		o.OTP = ""
+	}
+	if !isPlacer && !isRunner {
+		o.Phone = ""
+		o.Settlement = nil
+	}
+
+	return o
+}
+
+// ViewOrdersFor applies ViewFor to every order in the list.
+func ViewOrdersFor(orders []Order, viewer primitive.ObjectID) []Order {
+	views := make([]Order, len(orders))
+	for i, order := range orders {
+		views[i] = order.ViewFor(viewer)
+	}
+	return views
+}
+
+// Roles a viewer can have on an order.
+const (
+	RolePlacer = "placer"
+	RoleRunner = "runner"
+	RoleViewer = "viewer" // anyone else, for an order still in the feed
+)
+
+// OrderDetail is a single order as viewer is allowed to see it, with the parties'
+// profiles and a few values the client would otherwise have to work out itself.
+type OrderDetail struct {
+	Order
+	Role    string         `json:"role"`
+	Placer  *PublicProfile `json:"placer"`
+	Runner  *PublicProfile `json:"runner,omitempty"`
+	History []StatusChange `json:"history,omitempty"` // only for the placer and runner
+
+	AgeSeconds       int64  `json:"age_seconds"`                  // time since the order was placed
+	ExpiresInSeconds *int64 `json:"expires_in_seconds,omitempty"` // while the order is in the feed
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// PasswordReset is a single-use credential mailed to a user who forgot their password.
+// Only a hash of the token is stored.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	TokenHash string             `bson:"token_hash"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+	UsedAt    *time.Time         `bson:"used_at,omitempty"`
+}
+
+// PasswordResetStore persists reset tokens.
+type PasswordResetStore interface {
+	Insert(ctx context.Context, reset *PasswordReset) error
+	// Consume marks the unused, unexpired token with this hash used and returns it.
+	// It returns ErrNotFound if there is no such token, so a token can only be spent once.
+	Consume(ctx context.Context, hash string, now time.Time) (*PasswordReset, error)
+	// InvalidateForUser marks every unused token of the user used.
+	InvalidateForUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+type PasswordResetModel struct {
+	store     PasswordResetStore
+	userStore UserStore
+	tokens    RefreshTokenStore
+	tx        TxRunner
+	ttl       time.Duration
+}
+
+func NewPasswordResetModel(store PasswordResetStore, userStore UserStore, tokens RefreshTokenStore, tx TxRunner, ttl time.Duration) *PasswordResetModel {
+	return &PasswordResetModel{store: store, userStore: userStore, tokens: tokens, tx: tx, ttl: ttl}
+}
+
+// TTL is how long an issued token stays valid.
+func (m *PasswordResetModel) TTL() time.Duration {
+	return m.ttl
+}
+
+// Issue returns a new reset token for the account with this email. Any token issued
+// earlier stops working. It returns ErrNotFound if no account has the email.
+func (m *PasswordResetModel) Issue(email string) (string, *User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := m.userStore.FindByEmail(ctx, email)
+	if err != nil {
+		return "", nil, err
+	}
+
+	raw, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	reset := &PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(m.ttl),
+		CreatedAt: now,
+	}
+
+	err = m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := m.store.InvalidateForUser(ctx, user.ID); err != nil {
+			return err
+		}
+		return m.store.Insert(ctx, reset)
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return raw, user, nil
+}
+
+// Reset spends raw, sets the owner's password to newPassword and ends all of the owner's
+// sessions, in one transaction. It returns the owner.
+func (m *PasswordResetModel) Reset(raw, newPassword string) (primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Hash first: bcrypt is slow and should not run inside the transaction
+	hashed, err := hashPassword(newPassword)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	var userID primitive.ObjectID
+	err = m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		reset, err := m.store.Consume(ctx, hashToken(raw), time.Now())
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		userID = reset.UserID
+
+		if err := m.userStore.SetPassword(ctx, reset.UserID, hashed); err != nil {
+			return err
+		}
+		if err := endSessions(ctx, m.userStore, m.tokens, reset.UserID); err != nil {
+			return err
+		}
+		return m.store.InvalidateForUser(ctx, reset.UserID)
+	})
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	return userID, nil
+}
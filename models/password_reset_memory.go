@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryPasswordResetStore is the in-memory implementation of PasswordResetStore.
+type MemoryPasswordResetStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryPasswordResetStore(db *MemoryDB) *MemoryPasswordResetStore {
+	return &MemoryPasswordResetStore{db: db}
+}
+
+func (s *MemoryPasswordResetStore) Insert(ctx context.Context, reset *PasswordReset) error {
+	defer s.db.lock(ctx)()
+
+	s.db.passwordResets[reset.ID] = *reset
+	return nil
+}
+
+func (s *MemoryPasswordResetStore) Consume(ctx context.Context, hash string, now time.Time) (*PasswordReset, error) {
+	defer s.db.lock(ctx)()
+
+	for id, reset := range s.db.passwordResets {
+		if reset.TokenHash != hash || reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+			continue
+		}
+		found := reset
+		reset.UsedAt = &now
+		s.db.passwordResets[id] = reset
+		return &found, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryPasswordResetStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID) error {
+	defer s.db.lock(ctx)()
+
+	now := time.Now()
+	for id, reset := range s.db.passwordResets {
+		if reset.UserID == userID && reset.UsedAt == nil {
+			reset.UsedAt = &now
+			s.db.passwordResets[id] = reset
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoPasswordResetStore is the MongoDB implementation of PasswordResetStore.
+type MongoPasswordResetStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoPasswordResetStore(collection *mongo.Collection) *MongoPasswordResetStore {
+	return &MongoPasswordResetStore{collection: collection}
+}
+
+func (s *MongoPasswordResetStore) Insert(ctx context.Context, reset *PasswordReset) error {
+	_, err := s.collection.InsertOne(ctx, reset)
+	return err
+}
+
+func (s *MongoPasswordResetStore) Consume(ctx context.Context, hash string, now time.Time) (*PasswordReset, error) {
+	filter := bson.M{
+		"token_hash": hash,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	update := bson.M{
+		"$set": bson.M{"used_at": now},
+	}
+
+	var reset PasswordReset
+	err := s.collection.FindOneAndUpdate(ctx, filter, update).Decode(&reset)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+
+	return &reset, nil
+}
+
+func (s *MongoPasswordResetStore) InvalidateForUser(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{
+		"user_id": userID,
+		"used_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"used_at": time.Now()},
+	}
+
+	_, err := s.collection.UpdateMany(ctx, filter, update)
+	return err
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rating is what one party of a completed order thinks of the other.
+type Rating struct {
+	Stars   int       `bson:"stars" json:"stars"` // 1 to 5
+	Comment string    `bson:"comment,omitempty" json:"comment,omitempty"`
+	At      time.Time `bson:"at" json:"at"`
+}
+
+// RatingSummary is the average of the ratings a user has received in one role.
+type RatingSummary struct {
+	Average float64 `json:"average"` // to one decimal; 0 when Count is 0
+	Count   int64   `json:"count"`
+}
+
+// Ratings is what others think of a user, as a runner and as a placer.
+type Ratings struct {
+	AsRunner RatingSummary `json:"as_runner"`
+	AsPlacer RatingSummary `json:"as_placer"`
+}
+
+var ErrAlreadyRated = errors.New("you have already rated this order")
+
+// summarise turns a star total over count ratings into a RatingSummary.
+func summarise(total, count int64) RatingSummary {
+	if count == 0 {
+		return RatingSummary{}
+	}
+	return RatingSummary{Average: math.Round(float64(total)/float64(count)*10) / 10, Count: count}
+}
+
+// RateOrder lets the placer rate the runner of a completed order, and the runner rate
+// the placer. Each may rate an order once.
+func (m *OrderModel) RateOrder(userID, orderID primitive.ObjectID, stars int, comment string) (*Rating, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	comment = strings.TrimSpace(comment)
+	if stars < 1 || stars > 5 {
+		return nil, fmt.Errorf("stars must be between 1 and 5")
+	}
+	if len(comment) > 500 {
+		return nil, fmt.Errorf("comment must be at most 500 characters")
+	}
+
+	order, err := m.findOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var role string
+	var existing *Rating
+	switch {
+	case order.PlacedBy == userID:
+		role, existing = RolePlacer, order.RunnerRating
+	case !order.AcceptedBy.IsZero() && order.AcceptedBy == userID:
+		role, existing = RoleRunner, order.PlacerRating
+	default:
+		return nil, ErrNotOrderParty
+	}
+	if order.Status != StatusCompleted {
+		return nil, ErrOrderNotCompleted
+	}
+	if existing != nil {
+		return nil, ErrAlreadyRated
+	}
+
+	rating := Rating{Stars: stars, Comment: comment, At: time.Now()}
+	if err := m.store.Rate(ctx, orderID, role, userID, rating); err != nil {
+		return nil, err
+	}
+	return &rating, nil
+}
@@ -2,36 +2,105 @@ package models
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// OrderFee is the number of coins a placer pays the runner for a completed order.
+const OrderFee = 10
+
+// SignupBonus is granted once a new user has verified their email address.
+const SignupBonus = 50
+
+// Hold states. A hold starts Active and is settled exactly once.
+const (
+	HoldActive   = "Active"
+	HoldReleased = "Released"
+	HoldCaptured = "Captured"
+)
+
+var (
+	ErrInsufficientCoins = errors.New("not enough coins to place the order")
+	ErrHoldSettled       = errors.New("coin hold already settled")
+)
+
+// Rewards is a user's coin balance. Coins is the total; Held of it is reserved for open orders.
 type Rewards struct {
 	ID    primitive.ObjectID `bson:"_id" json:"id,omitempty"`
 	Coins int                `bson:"coins" json:"coins"`
+	Held  int                `bson:"held" json:"held"`
+}
+
+// Available is the part of the balance that is free to spend on new orders.
+func (r *Rewards) Available() int {
+	return r.Coins - r.Held
+}
+
+// CoinHold reserves a placer's fee from the moment an order is placed until it is
+// cancelled (Released) or completed (Captured). There is at most one hold per order.
+type CoinHold struct {
+	OrderID   primitive.ObjectID `bson:"_id" json:"order_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Amount    int                `bson:"amount" json:"amount"`
+	Status    string             `bson:"status" json:"status"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	SettledAt *time.Time         `bson:"settled_at,omitempty" json:"settled_at,omitempty"`
+}
+
+// RewardsStore persists coin balances, keyed by user ID, and the holds against them.
+// The balances are a cache of the ledger; see LedgerStore.
+type RewardsStore interface {
+	Insert(ctx context.Context, reward *Rewards) error
+	FindByUserID(ctx context.Context, userID primitive.ObjectID) (*Rewards, error)
+	IncrementCoins(ctx context.Context, userID primitive.ObjectID, amount int) (*Rewards, error)
+	// Reserve adds amount to Held only if at least that much is available, else ErrInsufficientCoins.
+	Reserve(ctx context.Context, userID primitive.ObjectID, amount int) error
+	// Adjust adds the given deltas to Coins and Held.
+	Adjust(ctx context.Context, userID primitive.ObjectID, coins, held int) error
+	SetBalance(ctx context.Context, userID primitive.ObjectID, coins, held int) error
+	InsertHold(ctx context.Context, hold *CoinHold) error
+	// SettleHold moves an Active hold to status. It returns ErrHoldSettled if the hold is no longer Active.
+	SettleHold(ctx context.Context, orderID primitive.ObjectID, status string) (*CoinHold, error)
 }
 
 type RewardsModel struct {
-	collection *mongo.Collection
+	store  RewardsStore
+	ledger LedgerStore
+	tx     TxRunner
 }
 
-func NewRewardsModel(collection *mongo.Collection) *RewardsModel {
-	return &RewardsModel{collection: collection}
+func NewRewardsModel(store RewardsStore, ledger LedgerStore, tx TxRunner) *RewardsModel {
+	return &RewardsModel{store: store, ledger: ledger, tx: tx}
 }
 
+// CreateRewardsOnSignup opens an empty balance; the bonus follows on email verification.
 func (r *RewardsModel) CreateRewardsOnSignup(userID primitive.ObjectID) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	reward := Rewards{
 		ID:    userID,
-		Coins: 50,
+		Coins: 0,
 	}
 
-	_, err := r.collection.InsertOne(ctx, reward)
+	return r.store.Insert(ctx, &reward)
+}
+
+// grantSignupBonus issues SignupBonus coins from the treasury. Callers make sure it runs once per user.
+func (r *RewardsModel) grantSignupBonus(ctx context.Context, userID primitive.ObjectID) error {
+	err := r.record(ctx, primitive.NilObjectID,
+		leg{TreasuryAccount, BucketAvailable, -SignupBonus, ReasonSignupBonus},
+		leg{userID, BucketAvailable, SignupBonus, ReasonSignupBonus},
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.store.IncrementCoins(ctx, userID, SignupBonus)
 	return err
 }
 
@@ -39,28 +108,218 @@ func (r *RewardsModel) GetRewardsByUserID(userID primitive.ObjectID) (*Rewards,
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var reward Rewards
-	err := r.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&reward)
+	return r.store.FindByUserID(ctx, userID)
+}
+
+// Reconcile derives the user's balance from the ledger and repairs the cached
+// balance if the two disagree. The returned Rewards is the ledger's view. It writes,
+// so it runs as an admin job rather than on every balance read.
+func (r *RewardsModel) Reconcile(userID primitive.ObjectID) (*Rewards, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var reward *Rewards
+	err := r.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		cached, err := r.store.FindByUserID(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		if err := r.openAccount(ctx, userID); err != nil {
+			return err
+		}
+
+		available, held, err := r.ledger.Balances(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		reward = &Rewards{ID: userID, Coins: available + held, Held: held}
+		if cached.Coins == reward.Coins && cached.Held == reward.Held {
+			return nil
+		}
+
+		log.Printf("rewards for %s out of sync with ledger (cached %d/%d, ledger %d/%d); repairing",
+			userID.Hex(), cached.Coins, cached.Held, reward.Coins, reward.Held)
+		return r.store.SetBalance(ctx, userID, reward.Coins, reward.Held)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &reward, nil
+	return reward, nil
 }
 
-func (r *RewardsModel) UpdateCoins(userID primitive.ObjectID, amount int) (*Rewards, error) {
+// GetHistory returns one page of the user's ledger entries, newest first, and the total entry count.
+func (r *RewardsModel) GetHistory(userID primitive.ObjectID, page, limit int) ([]LedgerEntry, int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$inc": bson.M{"coins": amount}, // inc: increment
+	entries, total, err := r.ledger.History(ctx, userID, (page-1)*limit, limit)
+	if err != nil {
+		return []LedgerEntry{}, 0, err
+	}
+
+	if entries == nil {
+		entries = []LedgerEntry{}
+	}
+
+	return entries, total, nil
+}
+
+// The helpers below are called by OrderModel inside a transaction together with the order
+// write that justifies them. Each records the movement in the ledger before touching the
+// cached balance.
+
+// holdOrderFee reserves the fee for a newly placed order.
+func (r *RewardsModel) holdOrderFee(ctx context.Context, userID, orderID primitive.ObjectID) error {
+	// Reserve before writing the ledger so a refused hold leaves no entries behind,
+	// even where the store cannot roll back
+	if err := r.openAccount(ctx, userID); err != nil {
+		return err
 	}
 
-	var updatedReward Rewards
-	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, update).Decode(&updatedReward)
+	if err := r.store.Reserve(ctx, userID, OrderFee); err != nil {
+		return err
+	}
+
+	err := r.appendLegs(ctx, orderID, []leg{
+		{userID, BucketAvailable, -OrderFee, ReasonOrderHold},
+		{userID, BucketHeld, OrderFee, ReasonOrderHold},
+	})
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	return r.store.InsertHold(ctx, &CoinHold{
+		OrderID:   orderID,
+		UserID:    userID,
+		Amount:    OrderFee,
+		Status:    HoldActive,
+		CreatedAt: time.Now(),
+	})
+}
+
+// releaseHold gives the reserved fee back to the placer.
+func (r *RewardsModel) releaseHold(ctx context.Context, orderID primitive.ObjectID) error {
+	hold, err := r.store.SettleHold(ctx, orderID, HoldReleased)
+	if errors.Is(err, ErrNotFound) {
+		return nil // order placed before holds existed: nothing was reserved
+	}
+	if err != nil {
+		return err
+	}
+
+	err = r.record(ctx, orderID,
+		leg{hold.UserID, BucketHeld, -hold.Amount, ReasonOrderRefund},
+		leg{hold.UserID, BucketAvailable, hold.Amount, ReasonOrderRefund},
+	)
+	if err != nil {
+		return err
+	}
+
+	return r.store.Adjust(ctx, hold.UserID, 0, -hold.Amount)
+}
+
+// captureHold turns the reserved fee into a payment from placer to runner.
+func (r *RewardsModel) captureHold(ctx context.Context, orderID, placer, runner primitive.ObjectID) error {
+	hold, err := r.store.SettleHold(ctx, orderID, HoldCaptured)
+	if errors.Is(err, ErrNotFound) {
+		return r.transfer(ctx, orderID, placer, runner, OrderFee) // order placed before holds existed
+	}
+	if err != nil {
+		return err
+	}
+
+	err = r.record(ctx, orderID,
+		leg{hold.UserID, BucketHeld, -hold.Amount, ReasonOrderFee},
+		leg{runner, BucketAvailable, hold.Amount, ReasonRunnerPayout},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := r.store.Adjust(ctx, hold.UserID, -hold.Amount, -hold.Amount); err != nil {
+		return fmt.Errorf("failed to deduct coins from order creator: %v", err)
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, runner, hold.Amount); err != nil {
+		return fmt.Errorf("failed to add coins to order accepter: %v", err)
+	}
+
+	return nil
+}
+
+// payReleasePenalty moves amount coins from a runner who released an order to its placer.
+// It returns ErrInsufficientCoins if the runner cannot afford it.
+func (r *RewardsModel) payReleasePenalty(ctx context.Context, orderID, runner, placer primitive.ObjectID, amount int) error {
+	reward, err := r.store.FindByUserID(ctx, runner)
+	if err != nil {
+		return err
+	}
+	if reward.Available() < amount {
+		return ErrInsufficientCoins
+	}
+
+	err = r.record(ctx, orderID,
+		leg{runner, BucketAvailable, -amount, ReasonReleasePenalty},
+		leg{placer, BucketAvailable, amount, ReasonReleasePenalty},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, runner, -amount); err != nil {
+		return fmt.Errorf("failed to deduct coins from runner: %v", err)
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, placer, amount); err != nil {
+		return fmt.Errorf("failed to add coins to order creator: %v", err)
+	}
+
+	return nil
+}
+
+// refundPaidFee gives the placer back a fee that was already paid to the runner, when a
+// dispute raised after completion is settled in the placer's favour. The runner's balance
+// may go negative; they cannot place orders until it recovers.
+func (r *RewardsModel) refundPaidFee(ctx context.Context, orderID, runner, placer primitive.ObjectID) error {
+	err := r.record(ctx, orderID,
+		leg{runner, BucketAvailable, -OrderFee, ReasonDisputeRefund},
+		leg{placer, BucketAvailable, OrderFee, ReasonDisputeRefund},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, runner, -OrderFee); err != nil {
+		return fmt.Errorf("failed to deduct coins from runner: %v", err)
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, placer, OrderFee); err != nil {
+		return fmt.Errorf("failed to add coins to order creator: %v", err)
+	}
+
+	return nil
+}
+
+// transfer moves amount available coins between two users.
+func (r *RewardsModel) transfer(ctx context.Context, orderID, from, to primitive.ObjectID, amount int) error {
+	err := r.record(ctx, orderID,
+		leg{from, BucketAvailable, -amount, ReasonOrderFee},
+		leg{to, BucketAvailable, amount, ReasonRunnerPayout},
+	)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, from, -amount); err != nil {
+		return fmt.Errorf("failed to deduct coins from order creator: %v", err)
+	}
+
+	if _, err := r.store.IncrementCoins(ctx, to, amount); err != nil {
+		return fmt.Errorf("failed to add coins to order accepter: %v", err)
 	}
 
-	return &updatedReward, nil
+	return nil
 }
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryRewardsStore is the in-memory implementation of RewardsStore.
+type MemoryRewardsStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryRewardsStore(db *MemoryDB) *MemoryRewardsStore {
+	return &MemoryRewardsStore{db: db}
+}
+
+func (s *MemoryRewardsStore) Insert(ctx context.Context, reward *Rewards) error {
+	defer s.db.lock(ctx)()
+
+	if _, exists := s.db.rewards[reward.ID]; exists {
+		return errors.New("rewards already exist for this user")
+	}
+	s.db.rewards[reward.ID] = *reward
+	return nil
+}
+
+func (s *MemoryRewardsStore) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*Rewards, error) {
+	defer s.db.rlock(ctx)()
+
+	reward, ok := s.db.rewards[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &reward, nil
+}
+
+// IncrementCoins mirrors FindOneAndUpdate and returns the balance from before the change.
+func (s *MemoryRewardsStore) IncrementCoins(ctx context.Context, userID primitive.ObjectID, amount int) (*Rewards, error) {
+	defer s.db.lock(ctx)()
+
+	reward, ok := s.db.rewards[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	before := reward
+	reward.Coins += amount
+	s.db.rewards[userID] = reward
+	return &before, nil
+}
+
+func (s *MemoryRewardsStore) Reserve(ctx context.Context, userID primitive.ObjectID, amount int) error {
+	defer s.db.lock(ctx)()
+
+	reward, ok := s.db.rewards[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	if reward.Available() < amount {
+		return ErrInsufficientCoins
+	}
+	reward.Held += amount
+	s.db.rewards[userID] = reward
+	return nil
+}
+
+func (s *MemoryRewardsStore) Adjust(ctx context.Context, userID primitive.ObjectID, coins, held int) error {
+	defer s.db.lock(ctx)()
+
+	reward, ok := s.db.rewards[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	reward.Coins += coins
+	reward.Held += held
+	s.db.rewards[userID] = reward
+	return nil
+}
+
+func (s *MemoryRewardsStore) SetBalance(ctx context.Context, userID primitive.ObjectID, coins, held int) error {
+	defer s.db.lock(ctx)()
+
+	reward, ok := s.db.rewards[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	reward.Coins = coins
+	reward.Held = held
+	s.db.rewards[userID] = reward
+	return nil
+}
+
+func (s *MemoryRewardsStore) InsertHold(ctx context.Context, hold *CoinHold) error {
+	defer s.db.lock(ctx)()
+
+	if _, exists := s.db.holds[hold.OrderID]; exists {
+		return errors.New("coin hold already exists for this order")
+	}
+	s.db.holds[hold.OrderID] = *hold
+	return nil
+}
+
+func (s *MemoryRewardsStore) SettleHold(ctx context.Context, orderID primitive.ObjectID, status string) (*CoinHold, error) {
+	defer s.db.lock(ctx)()
+
+	hold, ok := s.db.holds[orderID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if hold.Status != HoldActive {
+		return nil, ErrHoldSettled
+	}
+	now := time.Now()
+	hold.Status = status
+	hold.SettledAt = &now
+	s.db.holds[orderID] = hold
+	return &hold, nil
+}
@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRewardsStore is the MongoDB implementation of RewardsStore.
+type MongoRewardsStore struct {
+	collection *mongo.Collection
+	holds      *mongo.Collection
+}
+
+func NewMongoRewardsStore(collection, holds *mongo.Collection) *MongoRewardsStore {
+	return &MongoRewardsStore{collection: collection, holds: holds}
+}
+
+func (s *MongoRewardsStore) Insert(ctx context.Context, reward *Rewards) error {
+	_, err := s.collection.InsertOne(ctx, reward)
+	return err
+}
+
+func (s *MongoRewardsStore) FindByUserID(ctx context.Context, userID primitive.ObjectID) (*Rewards, error) {
+	var reward Rewards
+	err := s.collection.FindOne(ctx, bson.M{"_id": userID}).Decode(&reward)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+
+	return &reward, nil
+}
+
+func (s *MongoRewardsStore) IncrementCoins(ctx context.Context, userID primitive.ObjectID, amount int) (*Rewards, error) {
+	update := bson.M{
+		"$inc": bson.M{"coins": amount}, // inc: increment
+	}
+
+	var updatedReward Rewards
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, update).Decode(&updatedReward)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+
+	return &updatedReward, nil
+}
+
+func (s *MongoRewardsStore) Reserve(ctx context.Context, userID primitive.ObjectID, amount int) error {
+	filter := bson.M{
+		"_id": userID,
+		// coins - held >= amount; documents written before holds existed have no held field
+		"$expr": bson.M{"$gte": bson.A{
+			bson.M{"$subtract": bson.A{"$coins", bson.M{"$ifNull": bson.A{"$held", 0}}}},
+			amount,
+		}},
+	}
+	update := bson.M{
+		"$inc": bson.M{"held": amount},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	if _, err := s.FindByUserID(ctx, userID); err != nil {
+		return err
+	}
+	return ErrInsufficientCoins
+}
+
+func (s *MongoRewardsStore) Adjust(ctx context.Context, userID primitive.ObjectID, coins, held int) error {
+	update := bson.M{
+		"$inc": bson.M{"coins": coins, "held": held},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoRewardsStore) SetBalance(ctx context.Context, userID primitive.ObjectID, coins, held int) error {
+	update := bson.M{
+		"$set": bson.M{"coins": coins, "held": held},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoRewardsStore) InsertHold(ctx context.Context, hold *CoinHold) error {
+	_, err := s.holds.InsertOne(ctx, hold)
+	return err
+}
+
+func (s *MongoRewardsStore) SettleHold(ctx context.Context, orderID primitive.ObjectID, status string) (*CoinHold, error) {
+	filter := bson.M{
+		"_id":    orderID,
+		"status": HoldActive,
+	}
+	update := bson.M{
+		"$set": bson.M{"status": status, "settled_at": time.Now()},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var hold CoinHold
+	err := s.holds.FindOneAndUpdate(ctx, filter, update, opts).Decode(&hold)
+	if err == nil {
+		return &hold, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	// Either there is no hold for this order or it was settled already
+	if err := s.holds.FindOne(ctx, bson.M{"_id": orderID}).Err(); err != nil {
+		return nil, mongoErr(err)
+	}
+	return nil, ErrHoldSettled
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Shop is a store in the catalog. It is called Shop in code so it cannot be mistaken
+// for the ...Store persistence interfaces; the collection and the API call it a store.
+type Shop struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Location  string             `bson:"location" json:"location"`
+	Category  string             `bson:"category" json:"category"`
+	Hours     []OpeningHours     `bson:"hours" json:"hours"` // none means always open
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+
+	OpenNow bool `bson:"-" json:"open_now"` // filled in by ShopModel
+}
+
+// OpeningHours is one opening on one day of the week, in campus time. Open and Close
+// are "HH:MM"; a Close not after Open runs past midnight, and "24:00" closes at midnight.
+type OpeningHours struct {
+	Day   string `bson:"day" json:"day"` // "mon" to "sun"
+	Open  string `bson:"open" json:"open"`
+	Close string `bson:"close" json:"close"`
+}
+
+// Weekdays are the day names OpeningHours uses, indexed by time.Weekday.
+var Weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var (
+	ErrShopNotFound = fmt.Errorf("store %w", ErrNotFound)
+	ErrShopClosed   = errors.New("store is closed now")
+)
+
+// ShopStore persists the store catalog. Implementations return ErrNotFound when no store
+// matches and a DuplicateError when the name is taken, ignoring case.
+type ShopStore interface {
+	Insert(ctx context.Context, shop *Shop) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*Shop, error)
+	// FindAll returns the stores in category, or every store if category is empty, by name.
+	FindAll(ctx context.Context, category string) ([]Shop, error)
+	Update(ctx context.Context, shop *Shop) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// isOpenAt reports whether the shop is open at t, which must be in campus time.
+func (s *Shop) isOpenAt(t time.Time) bool {
+	if len(s.Hours) == 0 {
+		return true
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	today := Weekdays[t.Weekday()]
+	yesterday := Weekdays[(t.Weekday()+6)%7]
+
+	for _, h := range s.Hours {
+		open, close := clockMinutes(h.Open), clockMinutes(h.Close)
+		if close > open {
+			if h.Day == today && now >= open && now < close {
+				return true
+			}
+			continue
+		}
+
+		// Runs past midnight: the evening of Day and the early hours of the next day
+		if (h.Day == today && now >= open) || (h.Day == yesterday && now < close) {
+			return true
+		}
+	}
+	return false
+}
+
+// clockMinutes turns a validated "HH:MM" into minutes after midnight.
+func clockMinutes(clock string) int {
+	hours, minutes, _ := strings.Cut(clock, ":")
+	h, _ := strconv.Atoi(hours)
+	m, _ := strconv.Atoi(minutes)
+	return h*60 + m
+}
+
+type ShopModel struct {
+	store    ShopStore
+	location *time.Location // campus time, which opening hours are given in
+}
+
+func NewShopModel(store ShopStore, location *time.Location) *ShopModel {
+	return &ShopModel{store: store, location: location}
+}
+
+// CreateShop adds a store to the catalog. The input is expected to be validated.
+func (m *ShopModel) CreateShop(shop *Shop) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	shop.ID = primitive.NewObjectID()
+	shop.CreatedAt = now
+	shop.UpdatedAt = now
+
+	if err := m.store.Insert(ctx, shop); err != nil {
+		return err
+	}
+	m.setOpenNow(shop, now)
+	return nil
+}
+
+// UpdateShop replaces the details of an existing store.
+func (m *ShopModel) UpdateShop(id primitive.ObjectID, shop *Shop) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	existing, err := m.store.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrShopNotFound
+		}
+		return err
+	}
+
+	shop.ID = id
+	shop.CreatedAt = existing.CreatedAt
+	shop.UpdatedAt = time.Now()
+
+	if err := m.store.Update(ctx, shop); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrShopNotFound
+		}
+		return err
+	}
+	m.setOpenNow(shop, shop.UpdatedAt)
+	return nil
+}
+
+// DeleteShop removes a store from the catalog. Orders keep the name they were placed with.
+func (m *ShopModel) DeleteShop(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := m.store.Delete(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return ErrShopNotFound
+	}
+	return err
+}
+
+func (m *ShopModel) GetShop(id primitive.ObjectID) (*Shop, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shop, err := m.store.FindByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrShopNotFound
+		}
+		return nil, err
+	}
+
+	m.setOpenNow(shop, time.Now())
+	return shop, nil
+}
+
+// GetShops lists the catalog by name, optionally only one category.
+func (m *ShopModel) GetShops(category string) ([]Shop, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shops, err := m.store.FindAll(ctx, category)
+	if err != nil {
+		return []Shop{}, err
+	}
+	if shops == nil {
+		return []Shop{}, nil
+	}
+
+	now := time.Now()
+	for i := range shops {
+		m.setOpenNow(&shops[i], now)
+	}
+	return shops, nil
+}
+
+func (m *ShopModel) setOpenNow(shop *Shop, now time.Time) {
+	shop.OpenNow = shop.isOpenAt(now.In(m.location))
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryShopStore is the in-memory implementation of ShopStore.
+type MemoryShopStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryShopStore(db *MemoryDB) *MemoryShopStore {
+	return &MemoryShopStore{db: db}
+}
+
+func (s *MemoryShopStore) Insert(ctx context.Context, shop *Shop) error {
+	defer s.db.lock(ctx)()
+
+	if s.nameTaken(shop) {
+		return &DuplicateError{Field: "name"}
+	}
+	s.db.shops[shop.ID] = *shop
+	return nil
+}
+
+func (s *MemoryShopStore) FindByID(ctx context.Context, id primitive.ObjectID) (*Shop, error) {
+	defer s.db.rlock(ctx)()
+
+	shop, ok := s.db.shops[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &shop, nil
+}
+
+func (s *MemoryShopStore) FindAll(ctx context.Context, category string) ([]Shop, error) {
+	defer s.db.rlock(ctx)()
+
+	var shops []Shop
+	for _, shop := range s.db.shops {
+		if category == "" || shop.Category == category {
+			shops = append(shops, shop)
+		}
+	}
+
+	sort.Slice(shops, func(i, j int) bool {
+		return shops[i].Name < shops[j].Name
+	})
+	return shops, nil
+}
+
+func (s *MemoryShopStore) Update(ctx context.Context, shop *Shop) error {
+	defer s.db.lock(ctx)()
+
+	if _, ok := s.db.shops[shop.ID]; !ok {
+		return ErrNotFound
+	}
+	if s.nameTaken(shop) {
+		return &DuplicateError{Field: "name"}
+	}
+	s.db.shops[shop.ID] = *shop
+	return nil
+}
+
+func (s *MemoryShopStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	defer s.db.lock(ctx)()
+
+	if _, ok := s.db.shops[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.db.shops, id)
+	return nil
+}
+
+// nameTaken mirrors the case-insensitive unique index on stores.name.
+func (s *MemoryShopStore) nameTaken(shop *Shop) bool {
+	for _, existing := range s.db.shops {
+		if existing.ID != shop.ID && strings.EqualFold(existing.Name, shop.Name) {
+			return true
+		}
+	}
+	return false
+}
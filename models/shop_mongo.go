@@ -0,0 +1,74 @@
+package models
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoShopStore is the MongoDB implementation of ShopStore.
+type MongoShopStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoShopStore(collection *mongo.Collection) *MongoShopStore {
+	return &MongoShopStore{collection: collection}
+}
+
+func (s *MongoShopStore) Insert(ctx context.Context, shop *Shop) error {
+	_, err := s.collection.InsertOne(ctx, shop)
+	return mongoErr(err)
+}
+
+func (s *MongoShopStore) FindByID(ctx context.Context, id primitive.ObjectID) (*Shop, error) {
+	var shop Shop
+	if err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&shop); err != nil {
+		return nil, mongoErr(err)
+	}
+	return &shop, nil
+}
+
+func (s *MongoShopStore) FindAll(ctx context.Context, category string) ([]Shop, error) {
+	filter := bson.M{}
+	if category != "" {
+		filter["category"] = category
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := s.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var shops []Shop
+	if err := cursor.All(ctx, &shops); err != nil {
+		return nil, err
+	}
+	return shops, nil
+}
+
+func (s *MongoShopStore) Update(ctx context.Context, shop *Shop) error {
+	result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": shop.ID}, shop)
+	if err != nil {
+		return mongoErr(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *MongoShopStore) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
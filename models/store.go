@@ -0,0 +1,60 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned by every store when the requested document does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is matched by every DuplicateError.
+var ErrDuplicate = errors.New("already exists")
+
+// DuplicateError is returned by stores when a write would break a unique index.
+// Field is the bson name of the indexed field.
+type DuplicateError struct {
+	Field string
+}
+
+func (e *DuplicateError) Error() string {
+	return e.Field + " already exists"
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return ErrDuplicate
+}
+
+// mongoErr translates driver errors into the store-agnostic errors above.
+func mongoErr(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return &DuplicateError{Field: duplicateKeyField(err)}
+	}
+	return err
+}
+
+// The server names the violated index in the message, e.g.
+// "E11000 duplicate key error collection: nita_buddy.users index: email_1 dup key: ..."
+var duplicateIndexPattern = regexp.MustCompile(`index: (\S+) dup key`)
+
+// duplicateKeyField recovers the field from the index name. Indexes on one field are named <field>_1.
+func duplicateKeyField(err error) string {
+	match := duplicateIndexPattern.FindStringSubmatch(err.Error())
+	if match == nil {
+		return "key"
+	}
+	return strings.TrimSuffix(match[1], "_1")
+}
+
+// TxRunner runs fn so that every store call made with the ctx it is given
+// commits or rolls back as one unit. fn may be retried and must be safe to re-run.
+type TxRunner interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
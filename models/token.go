@@ -0,0 +1,199 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// RefreshToken is a long-lived, single-use credential exchanged for a new access token.
+// Only a hash of the token is stored. Every rotation issues a successor in the same family;
+// presenting an already-used token revokes the whole family, since it means it leaked.
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	FamilyID  primitive.ObjectID `bson:"family_id"`
+	TokenHash string             `bson:"token_hash"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	CreatedAt time.Time          `bson:"created_at"`
+	RevokedAt *time.Time         `bson:"revoked_at,omitempty"`
+}
+
+// RefreshTokenStore persists refresh tokens. Implementations return ErrNotFound when no token matches.
+type RefreshTokenStore interface {
+	Insert(ctx context.Context, token *RefreshToken) error
+	FindByHash(ctx context.Context, hash string) (*RefreshToken, error)
+	// Revoke marks an unrevoked token revoked. It returns false if the token was already revoked.
+	Revoke(ctx context.Context, id primitive.ObjectID) (bool, error)
+	RevokeFamily(ctx context.Context, familyID primitive.ObjectID) error
+	RevokeAllForUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// endSessions rejects every access token issued to the user so far and revokes all of
+// their refresh tokens. Callers run it in the transaction that changes the credentials.
+func endSessions(ctx context.Context, users UserStore, tokens RefreshTokenStore, userID primitive.ObjectID) error {
+	if err := users.IncrementTokenVersion(ctx, userID); err != nil {
+		return err
+	}
+	return tokens.RevokeAllForUser(ctx, userID)
+}
+
+// RevokedToken blocks one access token, identified by its jti, until it would have expired
+// anyway. The Mongo collection has a TTL index on ExpiresAt so entries clean themselves up.
+type RevokedToken struct {
+	JTI       string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+}
+
+// RevocationStore persists revoked access tokens.
+type RevocationStore interface {
+	// Insert records the revocation. Revoking the same jti twice is not an error.
+	Insert(ctx context.Context, token *RevokedToken) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+type TokenModel struct {
+	store       RefreshTokenStore
+	revocations RevocationStore
+	refreshTTL  time.Duration
+}
+
+func NewTokenModel(store RefreshTokenStore, revocations RevocationStore, refreshTTL time.Duration) *TokenModel {
+	return &TokenModel{store: store, revocations: revocations, refreshTTL: refreshTTL}
+}
+
+// RevokeAccessToken rejects the access token with this jti from now until expiresAt.
+func (m *TokenModel) RevokeAccessToken(jti string, userID primitive.ObjectID, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return m.revocations.Insert(ctx, &RevokedToken{JTI: jti, UserID: userID, ExpiresAt: expiresAt})
+}
+
+func (m *TokenModel) IsAccessTokenRevoked(jti string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return m.revocations.IsRevoked(ctx, jti)
+}
+
+// RevokeRefreshToken ends the session raw belongs to. Tokens of other users are ignored.
+func (m *TokenModel) RevokeRefreshToken(raw string, userID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := m.store.FindByHash(ctx, hashToken(raw))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if token.UserID != userID {
+		return nil
+	}
+
+	return m.store.RevokeFamily(ctx, token.FamilyID)
+}
+
+// IssueRefreshToken starts a new token family for userID, e.g. on login.
+func (m *TokenModel) IssueRefreshToken(userID primitive.ObjectID) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return m.issue(ctx, userID, primitive.NewObjectID())
+}
+
+// RotateRefreshToken spends raw and returns its owner and a successor token.
+func (m *TokenModel) RotateRefreshToken(raw string) (primitive.ObjectID, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	token, err := m.store.FindByHash(ctx, hashToken(raw))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return primitive.NilObjectID, "", ErrInvalidRefreshToken
+		}
+		return primitive.NilObjectID, "", err
+	}
+
+	if token.RevokedAt != nil {
+		m.revokeReusedFamily(ctx, token)
+		return primitive.NilObjectID, "", ErrInvalidRefreshToken
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return primitive.NilObjectID, "", ErrInvalidRefreshToken
+	}
+
+	revoked, err := m.store.Revoke(ctx, token.ID)
+	if err != nil {
+		return primitive.NilObjectID, "", err
+	}
+	if !revoked {
+		// Lost a race with another use of the same token
+		m.revokeReusedFamily(ctx, token)
+		return primitive.NilObjectID, "", ErrInvalidRefreshToken
+	}
+
+	next, err := m.issue(ctx, token.UserID, token.FamilyID)
+	if err != nil {
+		return primitive.NilObjectID, "", err
+	}
+
+	return token.UserID, next, nil
+}
+
+func (m *TokenModel) revokeReusedFamily(ctx context.Context, token *RefreshToken) {
+	log.Printf("refresh token reuse detected for user %s; revoking token family", token.UserID.Hex())
+	if err := m.store.RevokeFamily(ctx, token.FamilyID); err != nil {
+		log.Printf("failed to revoke refresh token family %s: %v", token.FamilyID.Hex(), err)
+	}
+}
+
+func (m *TokenModel) issue(ctx context.Context, userID, familyID primitive.ObjectID) (string, error) {
+	raw, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := &RefreshToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(m.refreshTTL),
+		CreatedAt: now,
+	}
+
+	if err := m.store.Insert(ctx, token); err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// randomToken returns 256 random bits, URL-safe encoded.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
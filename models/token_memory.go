@@ -0,0 +1,107 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryRefreshTokenStore is the in-memory implementation of RefreshTokenStore.
+type MemoryRefreshTokenStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryRefreshTokenStore(db *MemoryDB) *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{db: db}
+}
+
+func (s *MemoryRefreshTokenStore) Insert(ctx context.Context, token *RefreshToken) error {
+	defer s.db.lock(ctx)()
+
+	s.db.refreshTokens[token.ID] = *token
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) FindByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	defer s.db.rlock(ctx)()
+
+	for _, token := range s.db.refreshTokens {
+		if token.TokenHash == hash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryRefreshTokenStore) Revoke(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	defer s.db.lock(ctx)()
+
+	token, ok := s.db.refreshTokens[id]
+	if !ok || token.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	token.RevokedAt = &now
+	s.db.refreshTokens[id] = token
+	return true, nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeFamily(ctx context.Context, familyID primitive.ObjectID) error {
+	defer s.db.lock(ctx)()
+
+	now := time.Now()
+	for id, token := range s.db.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.db.refreshTokens[id] = token
+		}
+	}
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID) error {
+	defer s.db.lock(ctx)()
+
+	now := time.Now()
+	for id, token := range s.db.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+			s.db.refreshTokens[id] = token
+		}
+	}
+	return nil
+}
+
+// MemoryRevocationStore is the in-memory implementation of RevocationStore.
+type MemoryRevocationStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryRevocationStore(db *MemoryDB) *MemoryRevocationStore {
+	return &MemoryRevocationStore{db: db}
+}
+
+func (s *MemoryRevocationStore) Insert(ctx context.Context, token *RevokedToken) error {
+	defer s.db.lock(ctx)()
+
+	// Drop expired entries, standing in for Mongo's TTL index
+	now := time.Now()
+	for jti, revoked := range s.db.revokedTokens {
+		if !revoked.ExpiresAt.After(now) {
+			delete(s.db.revokedTokens, jti)
+		}
+	}
+
+	if _, exists := s.db.revokedTokens[token.JTI]; !exists {
+		s.db.revokedTokens[token.JTI] = *token
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	defer s.db.rlock(ctx)()
+
+	token, ok := s.db.revokedTokens[jti]
+	return ok && token.ExpiresAt.After(time.Now()), nil
+}
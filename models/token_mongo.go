@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRefreshTokenStore is the MongoDB implementation of RefreshTokenStore.
+type MongoRefreshTokenStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRefreshTokenStore(collection *mongo.Collection) *MongoRefreshTokenStore {
+	return &MongoRefreshTokenStore{collection: collection}
+}
+
+func (s *MongoRefreshTokenStore) Insert(ctx context.Context, token *RefreshToken) error {
+	_, err := s.collection.InsertOne(ctx, token)
+	return err
+}
+
+func (s *MongoRefreshTokenStore) FindByHash(ctx context.Context, hash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := s.collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&token)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+
+	return &token, nil
+}
+
+func (s *MongoRefreshTokenStore) Revoke(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	filter := bson.M{
+		"_id":        id,
+		"revoked_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (s *MongoRefreshTokenStore) RevokeFamily(ctx context.Context, familyID primitive.ObjectID) error {
+	filter := bson.M{
+		"family_id":  familyID,
+		"revoked_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := s.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (s *MongoRefreshTokenStore) RevokeAllForUser(ctx context.Context, userID primitive.ObjectID) error {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+	}
+	update := bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	}
+
+	_, err := s.collection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// MongoRevocationStore is the MongoDB implementation of RevocationStore.
+type MongoRevocationStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoRevocationStore(collection *mongo.Collection) *MongoRevocationStore {
+	return &MongoRevocationStore{collection: collection}
+}
+
+func (s *MongoRevocationStore) Insert(ctx context.Context, token *RevokedToken) error {
+	update := bson.M{
+		"$setOnInsert": bson.M{"user_id": token.UserID, "expires_at": token.ExpiresAt},
+	}
+
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": token.JTI}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s *MongoRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	// The TTL monitor only runs once a minute, so check expiry here too
+	filter := bson.M{
+		"_id":        jti,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+
+	err := s.collection.FindOne(ctx, filter).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+
+	return err == nil, err
+}
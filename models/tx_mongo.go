@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNoTransactions is returned for a deployment that cannot run transactions.
+var ErrNoTransactions = errors.New("MongoDB deployment does not support transactions (it needs a replica set or sharded cluster); set ALLOW_NON_TRANSACTIONAL=true to run without them")
+
+// MongoTxRunner runs multi-document transactions. Transactions need a replica set or
+// sharded cluster. A standalone server is refused unless allowNonTransactional is set,
+// in which case fn runs without a transaction and writes that belong together may be
+// left half done.
+type MongoTxRunner struct {
+	client    *mongo.Client
+	supported bool
+}
+
+func NewMongoTxRunner(client *mongo.Client, allowNonTransactional bool) (*MongoTxRunner, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	supported := err == nil && (hello.SetName != "" || hello.Msg == "isdbgrid")
+	if !supported {
+		if !allowNonTransactional {
+			return nil, ErrNoTransactions
+		}
+		log.Println("MongoDB deployment does not support transactions; multi-document writes are not atomic")
+	}
+
+	return &MongoTxRunner{client: client, supported: supported}, nil
+}
+
+func (t *MongoTxRunner) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	// Already inside a transaction, or none available: run on the caller's context
+	if !t.supported || mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
@@ -5,12 +5,18 @@ import (
 	"errors"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// User roles. Documents written before roles existed have none and count as students.
+const (
+	RoleStudent = "student"
+	RoleAdmin   = "admin"
+)
+
 type User struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	Email      string             `bson:"email" json:"email"`
@@ -21,31 +27,65 @@ type User struct {
 	Hostel     string             `bson:"hostel" json:"hostel"`
 	Branch     string             `bson:"branch" json:"branch"`
 	Year       string             `bson:"year" json:"year"`
+	Role       string             `bson:"role" json:"role"`
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+
+	// EmailVerified gates the signup bonus and every order endpoint.
+	EmailVerified bool `bson:"email_verified" json:"email_verified"`
+
+	// TokenVersion is embedded in every access token; bumping it logs the user out everywhere.
+	TokenVersion int `bson:"token_version" json:"-"`
+}
+
+// UserStore persists users. Implementations return ErrNotFound when no user matches.
+type UserStore interface {
+	Insert(ctx context.Context, user *User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	IncrementTokenVersion(ctx context.Context, id primitive.ObjectID) error
+	SetPassword(ctx context.Context, id primitive.ObjectID, hashedPassword string) error
+	// MarkEmailVerified sets EmailVerified if the user still has this email and is not yet verified.
+	// It returns false if nothing changed.
+	MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string) (bool, error)
+}
+
+// PublicProfile is what one user may see of another. Email and Phone are only
+// filled in while the two share an active order.
+type PublicProfile struct {
+	ID                  primitive.ObjectID `json:"id"`
+	Name                string             `json:"name"`
+	Hostel              string             `json:"hostel"`
+	Year                string             `json:"year"`
+	CompletedDeliveries int64              `json:"completed_deliveries"`
+	Ratings             Ratings            `json:"ratings"`
+	Email               string             `json:"email,omitempty"`
+	Phone               string             `json:"phone,omitempty"`
 }
 
 type UserModel struct {
-	collection   *mongo.Collection
+	store        UserStore
+	orderStore   OrderStore
 	rewardsModel *RewardsModel // inject RewardsModel
+	tokens       RefreshTokenStore
+	tx           TxRunner
 }
 
-func NewUserModel(collection *mongo.Collection, rewardsModel *RewardsModel) *UserModel {
+func NewUserModel(store UserStore, orderStore OrderStore, rewardsModel *RewardsModel, tokens RefreshTokenStore, tx TxRunner) *UserModel {
 	return &UserModel{
-		collection:   collection,
+		store:        store,
+		orderStore:   orderStore,
 		rewardsModel: rewardsModel,
+		tokens:       tokens,
+		tx:           tx,
 	}
 }
 
 func (m *UserModel) Create(email, password, name, enrollment, phone, hostel, branch, year string) (*User, error) {
-	// check if user exists
-	var existingUser User
-	err := m.collection.FindOne(context.Background(), bson.M{"email": email}).Decode(&existingUser)
-	if err == nil {
-		return nil, errors.New("user already exists")
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
 	// Hash Password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		return nil, err
 	}
@@ -53,23 +93,22 @@ func (m *UserModel) Create(email, password, name, enrollment, phone, hostel, bra
 	// Create user
 	user := &User{
 		Email:      email,
-		Password:   string(hashedPassword),
+		Password:   hashedPassword,
 		Name:       name,
 		Enrollment: enrollment,
 		Phone:      phone,
 		Hostel:     hostel,
 		Branch:     branch,
 		Year:       year,
+		Role:       RoleStudent,
 		CreatedAt:  time.Now(),
 	}
 
-	result, err := m.collection.InsertOne(context.Background(), user)
-	if err != nil {
+	// The unique indexes on email and enrollment reject duplicates, even concurrent ones
+	if err := m.store.Insert(ctx, user); err != nil {
 		return nil, err
 	}
 
-	user.ID = result.InsertedID.(primitive.ObjectID)
-
 	err = m.rewardsModel.CreateRewardsOnSignup(user.ID)
 	if err != nil {
 		return nil, err
@@ -79,14 +118,10 @@ func (m *UserModel) Create(email, password, name, enrollment, phone, hostel, bra
 }
 
 func (m *UserModel) GetByEmail(email string) (*User, error) {
-	var user User
-	err := m.collection.FindOne(context.Background(), bson.M{"email": email}).Decode(&user)
-
-	if err != nil {
-		return nil, err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	return &user, nil
+	return m.store.FindByEmail(ctx, email)
 }
 
 func (m *UserModel) VerifyPassword(user *User, password string) bool {
@@ -94,16 +129,138 @@ func (m *UserModel) VerifyPassword(user *User, password string) bool {
 	return err == nil
 }
 
+// ChangePassword replaces the password after checking the current one.
+// The caller should end the user's sessions afterwards.
+func (m *UserModel) ChangePassword(id primitive.ObjectID, oldPassword, newPassword string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := m.store.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !m.VerifyPassword(user, oldPassword) {
+		return ErrWrongPassword
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The password only changes together with ending the sessions it let in
+	return m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := m.store.SetPassword(ctx, id, hashedPassword); err != nil {
+			return err
+		}
+		return endSessions(ctx, m.store, m.tokens, id)
+	})
+}
+
 func (m *UserModel) GetUserByID(id primitive.ObjectID) (*User, error) {
-	var user User
-	err := m.collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&user)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
+	user, err := m.store.FindByID(ctx, id)
 	if err != nil {
-		if err == mongo.ErrNilDocument {
+		if errors.Is(err, ErrNotFound) {
 			return nil, errors.New("User not found")
 		}
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
+}
+
+// VerifyEmail marks the address verified and grants the signup bonus, both at once.
+// It returns false if the user was already verified or has since changed email.
+func (m *UserModel) VerifyEmail(id primitive.ObjectID, email string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var verified bool
+	err := m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		verified, err = m.store.MarkEmailVerified(ctx, id, email)
+		if err != nil || !verified {
+			return err
+		}
+
+		return m.rewardsModel.grantSignupBonus(ctx, id)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return verified, nil
+}
+
+// InvalidateSessions bumps the user's token version so every access token issued so far is
+// rejected, and revokes all of the user's refresh tokens.
+func (m *UserModel) InvalidateSessions(id primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return m.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		return endSessions(ctx, m.store, m.tokens, id)
+	})
+}
+
+// GetPublicProfile returns the profile of id as seen by viewer.
+func (m *UserModel) GetPublicProfile(viewer, id primitive.ObjectID) (*PublicProfile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return publicProfile(ctx, m.store, m.orderStore, viewer, id)
+}
+
+// publicProfile builds the profile of id as seen by viewer. It is shared with OrderModel,
+// which shows the profiles of both parties on an order.
+func publicProfile(ctx context.Context, users UserStore, orders OrderStore, viewer, id primitive.ObjectID) (*PublicProfile, error) {
+	user, err := users.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	completed, err := orders.CountCompletedBy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ratings, err := orders.RatingsOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &PublicProfile{
+		ID:                  user.ID,
+		Name:                user.Name,
+		Hostel:              user.Hostel,
+		Year:                user.Year,
+		CompletedDeliveries: completed,
+		Ratings:             ratings,
+	}
+
+	shares := viewer == id
+	if !shares {
+		shares, err = orders.SharesActiveOrder(ctx, viewer, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if shares {
+		profile.Email = user.Email
+		profile.Phone = user.Phone
+	}
+
+	return profile, nil
+}
+
+func hashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
 }
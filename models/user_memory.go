@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryUserStore is the in-memory implementation of UserStore.
+type MemoryUserStore struct {
+	db *MemoryDB
+}
+
+func NewMemoryUserStore(db *MemoryDB) *MemoryUserStore {
+	return &MemoryUserStore{db: db}
+}
+
+func (s *MemoryUserStore) Insert(ctx context.Context, user *User) error {
+	defer s.db.lock(ctx)()
+
+	// Same unique indexes as EnsureIndexes creates in Mongo
+	for _, existing := range s.db.users {
+		if existing.Email == user.Email {
+			return &DuplicateError{Field: "email"}
+		}
+		if user.Enrollment != "" && existing.Enrollment == user.Enrollment {
+			return &DuplicateError{Field: "enrollment"}
+		}
+	}
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	s.db.users[user.ID] = *user
+	return nil
+}
+
+func (s *MemoryUserStore) FindByID(ctx context.Context, id primitive.ObjectID) (*User, error) {
+	defer s.db.rlock(ctx)()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryUserStore) FindByEmail(ctx context.Context, email string) (*User, error) {
+	defer s.db.rlock(ctx)()
+
+	for _, user := range s.db.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryUserStore) IncrementTokenVersion(ctx context.Context, id primitive.ObjectID) error {
+	defer s.db.lock(ctx)()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.TokenVersion++
+	s.db.users[id] = user
+	return nil
+}
+
+func (s *MemoryUserStore) SetPassword(ctx context.Context, id primitive.ObjectID, hashedPassword string) error {
+	defer s.db.lock(ctx)()
+
+	user, ok := s.db.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hashedPassword
+	s.db.users[id] = user
+	return nil
+}
+
+func (s *MemoryUserStore) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string) (bool, error) {
+	defer s.db.lock(ctx)()
+
+	user, ok := s.db.users[id]
+	if !ok || user.Email != email || user.EmailVerified {
+		return false, nil
+	}
+	user.EmailVerified = true
+	s.db.users[id] = user
+	return true, nil
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoUserStore is the MongoDB implementation of UserStore.
+type MongoUserStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoUserStore(collection *mongo.Collection) *MongoUserStore {
+	return &MongoUserStore{collection: collection}
+}
+
+func (s *MongoUserStore) Insert(ctx context.Context, user *User) error {
+	result, err := s.collection.InsertOne(ctx, user)
+	if err != nil {
+		return mongoErr(err)
+	}
+
+	user.ID = result.InsertedID.(primitive.ObjectID)
+	return nil
+}
+
+func (s *MongoUserStore) FindByID(ctx context.Context, id primitive.ObjectID) (*User, error) {
+	return s.findOne(ctx, bson.M{"_id": id})
+}
+
+func (s *MongoUserStore) FindByEmail(ctx context.Context, email string) (*User, error) {
+	return s.findOne(ctx, bson.M{"email": email})
+}
+
+func (s *MongoUserStore) IncrementTokenVersion(ctx context.Context, id primitive.ObjectID) error {
+	update := bson.M{
+		"$inc": bson.M{"token_version": 1},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoUserStore) SetPassword(ctx context.Context, id primitive.ObjectID, hashedPassword string) error {
+	update := bson.M{
+		"$set": bson.M{"password": hashedPassword},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *MongoUserStore) MarkEmailVerified(ctx context.Context, id primitive.ObjectID, email string) (bool, error) {
+	filter := bson.M{
+		"_id":            id,
+		"email":          email,
+		"email_verified": bson.M{"$ne": true},
+	}
+	update := bson.M{
+		"$set": bson.M{"email_verified": true},
+	}
+
+	result, err := s.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return result.ModifiedCount == 1, nil
+}
+
+func (s *MongoUserStore) findOne(ctx context.Context, filter bson.M) (*User, error) {
+	var user User
+	err := s.collection.FindOne(ctx, filter).Decode(&user)
+	if err != nil {
+		return nil, mongoErr(err)
+	}
+
+	return &user, nil
+}
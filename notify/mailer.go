@@ -0,0 +1,180 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/suraj/nitabuddy/config"
+)
+
+// Mailer delivers a plain-text email. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogMailer logs that an email would have gone out, instead of sending it. It leaves out
+// the body, which can hold tokens; use FileMailer to read those locally.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Printf("mail to=%s subject=%q (body not logged)", to, subject)
+	return nil
+}
+
+// FileMailer appends every email to a file instead of sending it. For local development.
+type FileMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileMailer(path string) *FileMailer {
+	return &FileMailer{path: path}
+}
+
+func (m *FileMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC1123Z), to, subject, body)
+	return err
+}
+
+// smtpTimeout bounds one delivery when the caller's context has no earlier deadline.
+const smtpTimeout = 30 * time.Second
+
+// SMTPMailer sends email through an SMTP server using PLAIN auth.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	auth     smtp.Auth
+	from     string // From: header, may carry a display name
+	envelope string // bare address for MAIL FROM
+}
+
+// NewSMTPMailer fails if from is not an address, with or without a display name.
+func NewSMTPMailer(host string, port int, username, password, from string) (*SMTPMailer, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q: %w", from, err)
+	}
+
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		auth:     smtp.PlainAuth("", username, password, host),
+		from:     from,
+		envelope: sender.Address,
+	}, nil
+}
+
+// Send follows smtp.SendMail, but gives up when ctx is done or smtpTimeout passes.
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	// Closing the connection unblocks whatever exchange is in flight when ctx ends
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if err := m.deliver(conn, to, msg); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("sending mail to %s: %w", to, ctx.Err())
+		}
+		return err
+	}
+	return nil
+}
+
+func (m *SMTPMailer) deliver(conn net.Conn, to, msg string) error {
+	c, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok {
+		if err := c.Auth(m.auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(m.envelope); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// NewMailer builds the Mailer selected by cfg.Sender.
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Sender {
+	case "":
+		return nil, fmt.Errorf("MAIL_SENDER is required with STORAGE_BACKEND=mongo (\"log\", \"file\" or \"smtp\")")
+	case "log":
+		return LogMailer{}, nil
+	case "file":
+		return NewFileMailer(cfg.FilePath), nil
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_SENDER=smtp needs SMTP_HOST")
+		}
+		mailer, err := NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPass, cfg.From)
+		if err != nil {
+			return nil, err
+		}
+		return mailer, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SENDER %q (expected \"log\", \"file\" or \"smtp\")", cfg.Sender)
+	}
+}
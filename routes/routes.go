@@ -3,29 +3,68 @@ package routes
 import (
 	"github.com/gorilla/mux"
 	"github.com/suraj/nitabuddy/handlers"
+	"github.com/suraj/nitabuddy/models"
 )
 
 // Setup configures all the routes for the application
-func Setup(r *mux.Router, authHandler *handlers.AuthHandler, orderHandler *handlers.OrderHandler, rewardsHanhler *handlers.RewardsHandler) {
+func Setup(r *mux.Router, authHandler *handlers.AuthHandler, orderHandler *handlers.OrderHandler, rewardsHanhler *handlers.RewardsHandler, shopHandler *handlers.ShopHandler) {
 
 	//Auth Routes
 	r.HandleFunc("/register", authHandler.Register).Methods("POST")
 	r.HandleFunc("/login", authHandler.Login).Methods("POST")
 	r.HandleFunc("/logout", authHandler.Logout).Methods("POST")
+	r.HandleFunc("/token/refresh", authHandler.RefreshToken).Methods("POST")
+	r.HandleFunc("/verify-email", authHandler.VerifyEmail).Methods("POST")
+	r.HandleFunc("/password/forgot", authHandler.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", authHandler.ResetPassword).Methods("POST")
+
+	// Store catalog
+	r.HandleFunc("/stores", shopHandler.FetchStores).Methods("GET")
+	r.HandleFunc("/stores/{id}", shopHandler.FetchStore).Methods("GET")
+
+	// Everything registered on protected requires a valid access token
+	protected := r.NewRoute().Subrouter()
+	protected.Use(authHandler.RequireAuth)
+
+	protected.HandleFunc("/logout/all", authHandler.LogoutAll).Methods("POST")
+	protected.HandleFunc("/verify-email/resend", authHandler.ResendVerification).Methods("POST")
+	protected.HandleFunc("/password", authHandler.ChangePassword).Methods("PUT")
 
 	// Profile
-	r.HandleFunc("/profile", authHandler.GetUserProfile).Methods("GET")
-	r.HandleFunc("/profile/{id}", authHandler.GetUserProfileFromID).Methods("GET")
-
-	// orders
-	r.HandleFunc("/order", orderHandler.PlaceOrder).Methods("POST")
-	r.HandleFunc("/allOrders", orderHandler.FetchOtherOrders).Methods("GET")
-	r.HandleFunc("/myOrders", orderHandler.FetchMyOrders).Methods("GET")
-	r.HandleFunc("/cancelMyOrder/{id}", orderHandler.CancelMyOrder).Methods("DELETE")
-	r.HandleFunc("/acceptOrder/{id}", orderHandler.AcceptOrder).Methods("PUT")
-	r.HandleFunc("/acceptedOrders", orderHandler.FetchAcceptedOrders).Methods("GET")
-	r.HandleFunc("/completeOrder", orderHandler.CompleteOrder).Methods("PUT")
+	protected.HandleFunc("/profile", authHandler.GetUserProfile).Methods("GET")
+	protected.HandleFunc("/profile/{id}", authHandler.GetUserProfileFromID).Methods("GET")
+
+	// orders: only for users with a verified email
+	orders := protected.NewRoute().Subrouter()
+	orders.Use(handlers.RequireVerifiedEmail)
+
+	orders.HandleFunc("/order", orderHandler.PlaceOrder).Methods("POST")
+	orders.HandleFunc("/allOrders", orderHandler.FetchOtherOrders).Methods("GET")
+	orders.HandleFunc("/myOrders", orderHandler.FetchMyOrders).Methods("GET")
+	orders.HandleFunc("/cancelMyOrder/{id}", orderHandler.CancelMyOrder).Methods("DELETE")
+	orders.HandleFunc("/agreeCancelOrder/{id}", orderHandler.AgreeCancelOrder).Methods("PUT")
+	orders.HandleFunc("/acceptOrder/{id}", orderHandler.AcceptOrder).Methods("PUT")
+	orders.HandleFunc("/releaseOrder/{id}", orderHandler.ReleaseOrder).Methods("PUT")
+	orders.HandleFunc("/acceptedOrders", orderHandler.FetchAcceptedOrders).Methods("GET")
+	orders.HandleFunc("/pickupOrder/{id}", orderHandler.PickUpOrder).Methods("PUT")
+	orders.HandleFunc("/completeOrder", orderHandler.CompleteOrder).Methods("PUT")
+	orders.HandleFunc("/confirmSettlement/{id}", orderHandler.ConfirmSettlement).Methods("PUT")
+	orders.HandleFunc("/rateOrder/{id}", orderHandler.RateOrder).Methods("PUT")
+	orders.HandleFunc("/disputeOrder/{id}", orderHandler.DisputeOrder).Methods("PUT")
+	orders.HandleFunc("/order/{id}", orderHandler.FetchOrder).Methods("GET")
+	orders.HandleFunc("/order/{id}/history", orderHandler.FetchOrderHistory).Methods("GET")
 
 	//rewards
-	r.HandleFunc("/rewards", rewardsHanhler.FetchRewardsByID).Methods("GET")
+	protected.HandleFunc("/rewards", rewardsHanhler.FetchRewardsByID).Methods("GET")
+	protected.HandleFunc("/rewards/history", rewardsHanhler.FetchRewardsHistory).Methods("GET")
+
+	// admin: store catalog, ledger maintenance and dispute resolution
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(handlers.RequireRole(models.RoleAdmin))
+
+	admin.HandleFunc("/stores", shopHandler.CreateStore).Methods("POST")
+	admin.HandleFunc("/stores/{id}", shopHandler.UpdateStore).Methods("PUT")
+	admin.HandleFunc("/stores/{id}", shopHandler.DeleteStore).Methods("DELETE")
+	admin.HandleFunc("/rewards/{id}/reconcile", rewardsHanhler.ReconcileRewards).Methods("POST")
+	admin.HandleFunc("/orders/{id}/resolve", orderHandler.ResolveDispute).Methods("PUT")
 }
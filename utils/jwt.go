@@ -1,42 +0,0 @@
-package utils
-
-import (
-	"errors"
-	"net/http"
-	"strings"
-
-	"github.com/golang-jwt/jwt/v5"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-)
-
-var JwtSecret = []byte("my-secret-key") // replace with actual secret key
-
-// ExtractUserIDFromToken extracts user ID from the JWT token in the request
-func ExtractUserIDFromToken(r *http.Request) (primitive.ObjectID, error) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		return primitive.NilObjectID, errors.New("missing Authorization header")
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return JwtSecret, nil
-	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithoutClaimsValidation())
-
-	if err != nil || !token.Valid {
-		return primitive.NilObjectID, errors.New("invalid token")
-	}
-
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok || claims["user_id"] == nil {
-		return primitive.NilObjectID, errors.New("invalid claims")
-	}
-
-	userIDHex := claims["user_id"].(string)
-	userID, err := primitive.ObjectIDFromHex(userIDHex)
-	if err != nil {
-		return primitive.NilObjectID, errors.New("invalid user ID format")
-	}
-
-	return userID, nil
-}
@@ -0,0 +1,63 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/suraj/nitabuddy/models"
+)
+
+// OrderItems is the optional itemised part of the body of POST /order. Amounts are in paise.
+type OrderItems struct {
+	Items    []models.OrderItem `json:"items"`
+	MaxSpend int64              `json:"max_spend_paise"` // 0 means no limit
+}
+
+const (
+	maxOrderItems = 30
+	maxItemPrice  = 100000_00 // ₹1,00,000 in paise, far beyond any campus errand
+)
+
+// Normalize trims the item names and notes.
+func (in *OrderItems) Normalize() {
+	for i := range in.Items {
+		in.Items[i].Name = strings.TrimSpace(in.Items[i].Name)
+		in.Items[i].Notes = strings.TrimSpace(in.Items[i].Notes)
+	}
+}
+
+// Validate checks normalized OrderItems and returns one error per bad field, or nil.
+func (in *OrderItems) Validate() FieldErrors {
+	errs := FieldErrors{}
+
+	if len(in.Items) > maxOrderItems {
+		errs["items"] = fmt.Sprintf("an order can have at most %d items", maxOrderItems)
+	}
+
+	for i, item := range in.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		switch {
+		case item.Name == "":
+			errs[field] = "item name is required"
+		case len(item.Name) > 100:
+			errs[field] = "item name must be at most 100 characters"
+		case item.Quantity < 1 || item.Quantity > 99:
+			errs[field] = "quantity must be between 1 and 99"
+		case item.EstimatedUnitPrice < 0 || item.EstimatedUnitPrice > maxItemPrice:
+			errs[field] = "estimated unit price is out of range"
+		case len(item.Notes) > 200:
+			errs[field] = "notes must be at most 200 characters"
+		}
+	}
+
+	if in.MaxSpend < 0 {
+		errs["max_spend_paise"] = "max spend cannot be negative"
+	} else if total := models.EstimatedTotal(in.Items); in.MaxSpend > 0 && total > in.MaxSpend && len(errs) == 0 {
+		errs["max_spend_paise"] = "the estimated total is more than the max spend"
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
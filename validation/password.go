@@ -0,0 +1,47 @@
+package validation
+
+// PasswordReset is the body of POST /password/reset.
+type PasswordReset struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+func (in *PasswordReset) Validate() FieldErrors {
+	errs := FieldErrors{}
+
+	if in.Token == "" {
+		errs["token"] = "reset token is required"
+	}
+	if msg := checkPassword(in.NewPassword); msg != "" {
+		errs["new_password"] = msg
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// PasswordChange is the body of PUT /password.
+type PasswordChange struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+func (in *PasswordChange) Validate() FieldErrors {
+	errs := FieldErrors{}
+
+	if in.OldPassword == "" {
+		errs["old_password"] = "current password is required"
+	}
+	if msg := checkPassword(in.NewPassword); msg != "" {
+		errs["new_password"] = msg
+	} else if in.NewPassword == in.OldPassword {
+		errs["new_password"] = "new password must be different from the current one"
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,109 @@
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/suraj/nitabuddy/config"
+)
+
+// FieldErrors maps an input field to a message the client can show next to it.
+type FieldErrors map[string]string
+
+// Registration is the sign-up form as the client submits it.
+type Registration struct {
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	Name       string `json:"name"`
+	Enrollment string `json:"enrollment"`
+	Phone      string `json:"phone"`
+	Hostel     string `json:"hostel"`
+	Branch     string `json:"branch"`
+	Year       string `json:"year"`
+}
+
+// Indian mobile number, optionally prefixed with +91
+var phonePattern = regexp.MustCompile(`^(\+91)?[6-9][0-9]{9}$`)
+
+// Normalize trims every field and canonicalises case where the value is case-insensitive.
+// The password is left untouched.
+func (in *Registration) Normalize() {
+	in.Email = strings.ToLower(strings.TrimSpace(in.Email))
+	in.Name = strings.TrimSpace(in.Name)
+	in.Enrollment = strings.ToUpper(strings.TrimSpace(in.Enrollment))
+	in.Phone = strings.ReplaceAll(strings.TrimSpace(in.Phone), " ", "")
+	in.Hostel = strings.TrimSpace(in.Hostel)
+	in.Branch = strings.TrimSpace(in.Branch)
+	in.Year = strings.TrimSpace(in.Year)
+}
+
+// Validate checks a normalized Registration and returns one error per bad field, or nil.
+func (in *Registration) Validate(campus config.CampusConfig) FieldErrors {
+	errs := FieldErrors{}
+
+	if addr, err := mail.ParseAddress(in.Email); err != nil || addr.Address != in.Email {
+		errs["email"] = "enter a valid email address"
+	} else if campus.EmailDomain != "" && !strings.HasSuffix(in.Email, "@"+campus.EmailDomain) {
+		errs["email"] = "use your @" + campus.EmailDomain + " email address"
+	}
+
+	if msg := checkPassword(in.Password); msg != "" {
+		errs["password"] = msg
+	}
+
+	if in.Name == "" {
+		errs["name"] = "name is required"
+	} else if len(in.Name) > 100 {
+		errs["name"] = "name must be at most 100 characters"
+	}
+
+	if !campus.EnrollmentPattern.MatchString(in.Enrollment) {
+		errs["enrollment"] = "enter a valid enrollment number"
+	}
+
+	if !phonePattern.MatchString(in.Phone) {
+		errs["phone"] = "enter a valid 10-digit mobile number"
+	}
+
+	checkOneOf(errs, "hostel", in.Hostel, campus.Hostels)
+	checkOneOf(errs, "branch", in.Branch, campus.Branches)
+	checkOneOf(errs, "year", in.Year, campus.Years)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func checkPassword(password string) string {
+	if len(password) < 8 {
+		return "password must be at least 8 characters"
+	}
+	if len(password) > 72 {
+		return "password must be at most 72 characters" // bcrypt ignores anything longer
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return "password must contain at least one letter and one digit"
+	}
+
+	return ""
+}
+
+func checkOneOf(errs FieldErrors, field, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		errs[field] = field + " must be one of: " + strings.Join(allowed, ", ")
+	}
+}
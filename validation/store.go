@@ -0,0 +1,82 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/suraj/nitabuddy/config"
+	"github.com/suraj/nitabuddy/models"
+)
+
+// Store is the body of the admin endpoints that create and update catalog stores.
+type Store struct {
+	Name     string                `json:"name"`
+	Location string                `json:"location"`
+	Category string                `json:"category"`
+	Hours    []models.OpeningHours `json:"hours"`
+}
+
+// "HH:MM" on a 24-hour clock. A store may also close at "24:00", see Validate
+var clockPattern = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// Normalize trims every field and lower-cases the category and day names.
+func (in *Store) Normalize() {
+	in.Name = strings.TrimSpace(in.Name)
+	in.Location = strings.TrimSpace(in.Location)
+	in.Category = strings.ToLower(strings.TrimSpace(in.Category))
+	for i := range in.Hours {
+		in.Hours[i].Day = strings.ToLower(strings.TrimSpace(in.Hours[i].Day))
+		in.Hours[i].Open = strings.TrimSpace(in.Hours[i].Open)
+		in.Hours[i].Close = strings.TrimSpace(in.Hours[i].Close)
+	}
+}
+
+// Validate checks a normalized Store and returns one error per bad field, or nil.
+func (in *Store) Validate(campus config.CampusConfig) FieldErrors {
+	errs := FieldErrors{}
+
+	if in.Name == "" {
+		errs["name"] = "name is required"
+	} else if len(in.Name) > 100 {
+		errs["name"] = "name must be at most 100 characters"
+	}
+
+	if len(in.Location) > 200 {
+		errs["location"] = "location must be at most 200 characters"
+	}
+
+	checkOneOf(errs, "category", in.Category, campus.StoreCategories)
+
+	for i, h := range in.Hours {
+		field := fmt.Sprintf("hours[%d]", i)
+		switch {
+		case !slices.Contains(models.Weekdays, h.Day):
+			errs[field] = "day must be one of: " + strings.Join(models.Weekdays, ", ")
+		case !clockPattern.MatchString(h.Open):
+			errs[field] = "open must be a time like 09:30"
+		case !clockPattern.MatchString(h.Close) && h.Close != "24:00":
+			errs[field] = "close must be a time like 21:00"
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Shop returns the validated input as a catalog store.
+func (in *Store) Shop() *models.Shop {
+	if in.Hours == nil {
+		in.Hours = []models.OpeningHours{}
+	}
+
+	return &models.Shop{
+		Name:     in.Name,
+		Location: in.Location,
+		Category: in.Category,
+		Hours:    in.Hours,
+	}
+}